@@ -0,0 +1,379 @@
+package booru
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kannonfoundry/api-go/api"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPageSize is the largest page every flavor will return.
+const maxPageSize = 100
+
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// BooruClient talks to one Booru instance. Provider adapts it to
+// api.MediaSearcher.
+type BooruClient struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// Option configures a BooruClient.
+type Option func(*BooruClient)
+
+// WithHTTPClient replaces the shared HTTP client. A nil client keeps the
+// shared one.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *BooruClient) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// NewClient creates a client for the instance described by config.
+func NewClient(config Config, opts ...Option) *BooruClient {
+	c := &BooruClient{
+		config:     config,
+		httpClient: defaultHTTPClient,
+	}
+	c.config.BaseURL = strings.TrimRight(c.config.BaseURL, "/")
+	if c.config.Format == "" {
+		c.config.Format = JSON
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// endpoint builds the URL for listing s ("post" or "tag") in format with
+// params plus the instance's credentials.
+func (c *BooruClient) endpoint(s string, format Format, params url.Values) string {
+	switch c.config.Flavor {
+	case Danbooru:
+		if c.config.Login != "" {
+			params.Set("login", c.config.Login)
+			params.Set("api_key", c.config.APIKey)
+		}
+		return c.config.BaseURL + "/" + s + "s." + string(format) + "?" + params.Encode()
+	case Moebooru:
+		if c.config.Login != "" {
+			params.Set("login", c.config.Login)
+			params.Set("password_hash", c.config.APIKey)
+		}
+		return c.config.BaseURL + "/" + s + "." + string(format) + "?" + params.Encode()
+	}
+	params.Set("page", "dapi")
+	params.Set("s", s)
+	params.Set("q", "index")
+	if format == JSON {
+		params.Set("json", "1")
+	}
+	if c.config.Login != "" {
+		params.Set("user_id", c.config.Login)
+		params.Set("api_key", c.config.APIKey)
+	}
+	return c.config.BaseURL + "/index.php?" + params.Encode()
+}
+
+func (c *BooruClient) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", c.config.Name, api.ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// checkResponse maps a non-200 response to the errors in package api.
+func (c *BooruClient) checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", c.config.Name, api.ErrNotFound)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s: %w: %s", c.config.Name, api.ErrUnauthorized, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &api.RateLimitError{}
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %w: %s", c.config.Name, api.ErrUpstream, resp.Status)
+	}
+	return fmt.Errorf("%s request failed: %s", c.config.Name, resp.Status)
+}
+
+// ratingValues maps api.Ratings onto each flavor's rating: metatag values.
+// Danbooru splits "safe" into general and sensitive.
+var ratingValues = map[Flavor]map[string]string{
+	Danbooru: {"safe": "g,s", "questionable": "q", "explicit": "e"},
+	Gelbooru: {"safe": "safe", "questionable": "questionable", "explicit": "explicit"},
+	Moebooru: {"safe": "s", "questionable": "q", "explicit": "e"},
+}
+
+// ratingTag turns a rating from api.Ratings into a rating: metatag, or ""
+// when rating is empty or unknown.
+func (c *BooruClient) ratingTag(rating string) string {
+	negate := strings.HasPrefix(rating, "-")
+	value, ok := ratingValues[c.config.Flavor][strings.TrimPrefix(rating, "-")]
+	if !ok {
+		return ""
+	}
+	if negate {
+		return "-rating:" + value
+	}
+	return "rating:" + value
+}
+
+// searchTags adds the rating filter, falling back to the instance's default,
+// unless the tags already contain a rating: metatag.
+func (c *BooruClient) searchTags(tags []string, rating string) []string {
+	for _, tag := range tags {
+		if strings.HasPrefix(strings.TrimPrefix(tag, "-"), "rating:") {
+			return tags
+		}
+	}
+	if rating == "" {
+		rating = c.config.Rating
+	}
+	if tag := c.ratingTag(rating); tag != "" {
+		return append(tags[:len(tags):len(tags)], tag)
+	}
+	return tags
+}
+
+// Search returns page (1-based) of posts matching tags, newest first. Tags
+// may be negated with a leading "-" and include metatags like "rating:s".
+func (c *BooruClient) Search(ctx context.Context, tags []string, rating string, count int, page int) ([]api.FileToSend, error) {
+	if count <= 0 || count > maxPageSize {
+		count = 20
+	}
+	if page < 1 {
+		page = 1
+	}
+	params := url.Values{}
+	params.Set("tags", strings.Join(c.searchTags(tags, rating), " "))
+	params.Set("limit", strconv.Itoa(count))
+	if c.config.Flavor == Gelbooru {
+		params.Set("pid", strconv.Itoa(page-1))
+	} else {
+		params.Set("page", strconv.Itoa(page))
+	}
+	return c.posts(ctx, params)
+}
+
+// GetPost looks up a single post by id.
+func (c *BooruClient) GetPost(ctx context.Context, id int64) (*api.FileToSend, error) {
+	params := url.Values{}
+	if c.config.Flavor == Gelbooru {
+		params.Set("id", strconv.FormatInt(id, 10))
+	} else {
+		params.Set("tags", "id:"+strconv.FormatInt(id, 10))
+	}
+	files, err := c.posts(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %w: post %d", c.config.Name, api.ErrNotFound, id)
+	}
+	return &files[0], nil
+}
+
+func (c *BooruClient) posts(ctx context.Context, params url.Values) ([]api.FileToSend, error) {
+	body, err := c.get(ctx, c.endpoint("post", c.config.Format, params))
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeRecords(c.config.Format, body, "post", "posts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s posts: %w", c.config.Name, err)
+	}
+
+	var results []api.FileToSend
+	for _, rec := range records {
+		if file := c.toFileToSend(rec); file != nil {
+			results = append(results, *file)
+		}
+	}
+	return results, nil
+}
+
+// ListTags returns up to limit tags starting with (Danbooru, Moebooru) or
+// containing (Gelbooru) prefix, most used first.
+func (c *BooruClient) ListTags(ctx context.Context, prefix string, limit int) ([]api.Tag, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(limit))
+	format := c.config.Format
+	switch c.config.Flavor {
+	case Danbooru:
+		params.Set("search[name_matches]", prefix+"*")
+		params.Set("search[order]", "count")
+	case Moebooru:
+		params.Set("name", prefix+"*")
+		params.Set("order", "count")
+	default:
+		params.Set("name_pattern", "%"+prefix+"%")
+		params.Set("orderby", "count")
+		// Not every Gelbooru version can list tags as JSON.
+		format = XML
+	}
+
+	body, err := c.get(ctx, c.endpoint("tag", format, params))
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeRecords(format, body, "tag", "tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s tags: %w", c.config.Name, err)
+	}
+
+	tags := make([]api.Tag, 0, len(records))
+	for _, rec := range records {
+		count := rec.int("count")
+		if c.config.Flavor == Danbooru {
+			count = rec.int("post_count")
+		}
+		if rec["name"] != "" {
+			tags = append(tags, api.Tag{Name: rec["name"], Count: count})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Count > tags[j].Count
+	})
+	return tags, nil
+}
+
+// ParseTags splits a free-text search into Booru tags. Spaces inside a tag
+// are written as underscores, so both whitespace and commas separate tags.
+func ParseTags(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// postFields names the record fields each flavor uses for a post.
+type postFields struct {
+	fileURL, sampleURL, previewURL, tags, width, height string
+}
+
+var (
+	danbooruFields = postFields{"file_url", "large_file_url", "preview_file_url", "tag_string", "image_width", "image_height"}
+	defaultFields  = postFields{"file_url", "sample_url", "preview_url", "tags", "width", "height"}
+)
+
+func isVideo(fileURL string) bool {
+	switch strings.ToLower(path.Ext(fileURL)) {
+	case ".mp4", ".webm", ".mov", ".m4v":
+		return true
+	}
+	return false
+}
+
+func (c *BooruClient) toFileToSend(rec record) *api.FileToSend {
+	fields := defaultFields
+	if c.config.Flavor == Danbooru {
+		fields = danbooruFields
+	}
+	id := rec.int("id")
+	fileURL := c.absoluteURL(rec[fields.fileURL])
+	sampleURL := c.absoluteURL(rec[fields.sampleURL])
+	previewURL := c.absoluteURL(rec[fields.previewURL])
+	if strings.EqualFold(path.Ext(fileURL), ".zip") {
+		// Danbooru ugoira: the zip is frames, the sample a webm.
+		fileURL = sampleURL
+	}
+	if id == 0 || fileURL == "" {
+		// Deleted posts, or ones the instance hides from anonymous users.
+		return nil
+	}
+
+	video := isVideo(fileURL)
+	poster := sampleURL
+	if video || poster == "" {
+		// For videos the sample is a still frame.
+		poster = previewURL
+	}
+	createdAt := rec.time("created_at")
+	if createdAt == 0 {
+		createdAt = rec.int("change")
+	}
+	return &api.FileToSend{
+		Name:         c.config.Name + "_" + strconv.FormatInt(id, 10),
+		Provider:     c.config.Name,
+		URL:          fileURL,
+		CreatedAt:    createdAt,
+		HDURL:        fileURL,
+		SDURL:        sampleURL,
+		PosterURL:    poster,
+		ThumbnailURL: previewURL,
+		Tags:         strings.Fields(rec[fields.tags]),
+		Duration:     rec.float("media_asset.duration"),
+		Width:        int(rec.int(fields.width)),
+		Height:       int(rec.int(fields.height)),
+		Likes:        rec.int("score"),
+		IsImage:      !video,
+	}
+}
+
+// absoluteURL resolves the protocol-relative and root-relative file URLs
+// some instances return.
+func (c *BooruClient) absoluteURL(u string) string {
+	switch {
+	case u == "":
+		return ""
+	case strings.HasPrefix(u, "//"):
+		return "https:" + u
+	case strings.HasPrefix(u, "/"):
+		return c.config.BaseURL + u
+	}
+	return u
+}
+
+func (r record) int(key string) int64 {
+	n, _ := strconv.ParseInt(r[key], 10, 64)
+	return n
+}
+
+func (r record) float(key string) float64 {
+	f, _ := strconv.ParseFloat(r[key], 64)
+	return f
+}
+
+// timeLayouts are the created_at formats seen across flavors; Moebooru uses
+// unix seconds instead.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"Mon Jan 02 15:04:05 -0700 2006", // Gelbooru
+	"2006-01-02 15:04:05",
+}
+
+// time returns key as unix seconds, or 0 when it is missing or unparseable.
+func (r record) time(key string) int64 {
+	value := r[key]
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Unix()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package booru
+
+import (
+	"context"
+	"kannonfoundry/api-go/api"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// created is 2024-01-02T08:04:05Z, the instant every fixture below uses.
+const created = 1704182645
+
+var searchTests = []struct {
+	name   string
+	flavor Flavor
+	format Format
+	rating string
+	// path and query are what the client must request.
+	path  string
+	query url.Values
+	body  string
+}{
+	{
+		name:   "danbooru json",
+		flavor: Danbooru,
+		format: JSON,
+		rating: "safe",
+		path:   "/posts.json",
+		query:  url.Values{"tags": {"cat rating:g,s"}, "page": {"2"}},
+		body: `[
+			{"id":1,"file_url":"https://cdn.test/1.mp4","large_file_url":"https://cdn.test/1-sample.mp4",
+			 "preview_file_url":"https://cdn.test/1-preview.jpg","tag_string":"cat solo","image_width":640,
+			 "image_height":480,"score":5,"created_at":"2024-01-02T03:04:05.000-05:00",
+			 "media_asset":{"duration":3.5}},
+			{"id":2,"file_url":null}
+		]`,
+	},
+	{
+		name:   "danbooru xml",
+		flavor: Danbooru,
+		format: XML,
+		rating: "safe",
+		path:   "/posts.xml",
+		query:  url.Values{"tags": {"cat rating:g,s"}, "page": {"2"}},
+		body: `<?xml version="1.0" encoding="UTF-8"?>
+			<posts type="array">
+			  <post>
+			    <id type="integer">1</id>
+			    <file-url>https://cdn.test/1.mp4</file-url>
+			    <large-file-url>https://cdn.test/1-sample.mp4</large-file-url>
+			    <preview-file-url>https://cdn.test/1-preview.jpg</preview-file-url>
+			    <tag-string>cat solo</tag-string>
+			    <image-width type="integer">640</image-width>
+			    <image-height type="integer">480</image-height>
+			    <score type="integer">5</score>
+			    <created-at type="datetime">2024-01-02T03:04:05.000-05:00</created-at>
+			    <media-asset><duration type="float">3.5</duration></media-asset>
+			  </post>
+			</posts>`,
+	},
+	{
+		name:   "gelbooru json",
+		flavor: Gelbooru,
+		format: JSON,
+		rating: "-explicit",
+		path:   "/index.php",
+		query:  url.Values{"tags": {"cat -rating:explicit"}, "pid": {"1"}, "json": {"1"}},
+		body: `{"@attributes":{"limit":20,"offset":20,"count":1},"post":[
+			{"id":1,"file_url":"//cdn.test/1.mp4","sample_url":"//cdn.test/1-sample.jpg",
+			 "preview_url":"//cdn.test/1-preview.jpg","tags":"cat solo","width":640,"height":480,
+			 "score":5,"created_at":"Tue Jan 02 03:04:05 -0500 2024","change":1}
+		]}`,
+	},
+	{
+		name:   "gelbooru xml",
+		flavor: Gelbooru,
+		format: XML,
+		rating: "-explicit",
+		path:   "/index.php",
+		query:  url.Values{"tags": {"cat -rating:explicit"}, "pid": {"1"}},
+		body: `<?xml version="1.0" encoding="UTF-8"?>
+			<posts count="1" offset="20">
+			  <post id="1" file_url="//cdn.test/1.mp4" sample_url="//cdn.test/1-sample.jpg"
+			    preview_url="//cdn.test/1-preview.jpg" tags=" cat solo " width="640" height="480"
+			    score="5" created_at="Tue Jan 02 03:04:05 -0500 2024" change="1"/>
+			</posts>`,
+	},
+	{
+		name:   "moebooru json",
+		flavor: Moebooru,
+		format: JSON,
+		rating: "questionable",
+		path:   "/post.json",
+		query:  url.Values{"tags": {"cat rating:q"}, "page": {"2"}},
+		body: `[
+			{"id":1,"file_url":"/data/1.mp4","sample_url":"/data/1-sample.jpg","preview_url":"/data/1-preview.jpg",
+			 "tags":"cat solo","width":640,"height":480,"score":5,"created_at":1704182645}
+		]`,
+	},
+	{
+		name:   "moebooru xml",
+		flavor: Moebooru,
+		format: XML,
+		rating: "questionable",
+		path:   "/post.xml",
+		query:  url.Values{"tags": {"cat rating:q"}, "page": {"2"}},
+		body: `<?xml version="1.0" encoding="UTF-8"?>
+			<posts count="1" offset="20">
+			  <post id="1" file_url="/data/1.mp4" sample_url="/data/1-sample.jpg" preview_url="/data/1-preview.jpg"
+			    tags="cat solo" width="640" height="480" score="5" created_at="1704182645"/>
+			</posts>`,
+	},
+}
+
+func TestSearch(t *testing.T) {
+	for _, tt := range searchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewClient(Config{Name: "test", Flavor: tt.flavor, BaseURL: srv.URL, Format: tt.format})
+			files, err := c.Search(context.Background(), []string{"cat"}, tt.rating, 20, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.URL.Path != tt.path {
+				t.Errorf("requested %s, want %s", got.URL.Path, tt.path)
+			}
+			for key := range tt.query {
+				if v := got.URL.Query().Get(key); v != tt.query.Get(key) {
+					t.Errorf("%s = %q, want %q", key, v, tt.query.Get(key))
+				}
+			}
+
+			// Every fixture describes the same video; only where its URLs
+			// point differs.
+			cdn := "https://cdn.test/"
+			if tt.flavor == Moebooru {
+				cdn = srv.URL + "/data/"
+			}
+			sample := cdn + "1-sample.jpg"
+			if tt.flavor == Danbooru {
+				sample = cdn + "1-sample.mp4"
+			}
+			want := []api.FileToSend{{
+				Name:         "test_1",
+				Provider:     "test",
+				URL:          cdn + "1.mp4",
+				CreatedAt:    created,
+				HDURL:        cdn + "1.mp4",
+				SDURL:        sample,
+				PosterURL:    cdn + "1-preview.jpg",
+				ThumbnailURL: cdn + "1-preview.jpg",
+				Tags:         []string{"cat", "solo"},
+				Width:        640,
+				Height:       480,
+				Likes:        5,
+			}}
+			if tt.flavor == Danbooru {
+				want[0].Duration = 3.5
+			}
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("got %+v\nwant %+v", files, want)
+			}
+		})
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	tests := []struct {
+		flavor        Flavor
+		defaultRating string
+		tags          []string
+		rating        string
+		want          []string
+	}{
+		{Danbooru, "", []string{"cat"}, "", []string{"cat"}},
+		{Danbooru, "", []string{"cat"}, "explicit", []string{"cat", "rating:e"}},
+		{Gelbooru, "", []string{"cat"}, "safe", []string{"cat", "rating:safe"}},
+		{Moebooru, "", []string{"cat"}, "-safe", []string{"cat", "-rating:s"}},
+		// The instance's rating applies unless the search picks one.
+		{Gelbooru, "safe", []string{"cat"}, "", []string{"cat", "rating:safe"}},
+		{Gelbooru, "safe", []string{"cat"}, "explicit", []string{"cat", "rating:explicit"}},
+		// A rating: metatag in the tags wins over both.
+		{Gelbooru, "safe", []string{"cat", "-rating:safe"}, "explicit", []string{"cat", "-rating:safe"}},
+		{Moebooru, "", []string{"cat"}, "unknown", []string{"cat"}},
+	}
+	for _, tt := range tests {
+		c := NewClient(Config{Flavor: tt.flavor, Rating: tt.defaultRating})
+		if got := c.searchTags(tt.tags, tt.rating); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s searchTags(%q, %q) with default %q = %q, want %q",
+				tt.flavor, tt.tags, tt.rating, tt.defaultRating, got, tt.want)
+		}
+	}
+}
+
+func TestListTags(t *testing.T) {
+	tests := []struct {
+		flavor Flavor
+		body   string
+	}{
+		{Danbooru, `[{"name":"cat","post_count":10},{"name":"cats","post_count":30}]`},
+		{Gelbooru, `<tags type="array"><tag name="cat" count="10"/><tag name="cats" count="30"/></tags>`},
+		{Moebooru, `[{"name":"cat","count":10},{"name":"cats","count":30}]`},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.body))
+		}))
+		c := NewClient(Config{Name: "test", Flavor: tt.flavor, BaseURL: srv.URL})
+		tags, err := c.ListTags(context.Background(), "cat", 10)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.flavor, err)
+		}
+		want := []api.Tag{{Name: "cats", Count: 30}, {Name: "cat", Count: 10}}
+		if !reflect.DeepEqual(tags, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.flavor, tags, want)
+		}
+	}
+}
+
+func TestEmptyResponse(t *testing.T) {
+	for _, format := range []Format{JSON, XML} {
+		records, err := decodeRecords(format, []byte(" \n"), "post")
+		if err != nil || len(records) != 0 {
+			t.Errorf("%s: got %v, %v; want no records", format, records, err)
+		}
+	}
+}
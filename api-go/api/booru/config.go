@@ -0,0 +1,105 @@
+package booru
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Flavor is the API shape a Booru site speaks.
+type Flavor string
+
+const (
+	// Danbooru is /posts.json with tag_string and image_width fields.
+	Danbooru Flavor = "danbooru"
+	// Gelbooru is the index.php?page=dapi API, also used by Safebooru and
+	// Rule34.
+	Gelbooru Flavor = "gelbooru"
+	// Moebooru is /post.json as used by yande.re and konachan.
+	Moebooru Flavor = "moebooru"
+)
+
+// Format is the response format requested from the site.
+type Format string
+
+const (
+	JSON Format = "json"
+	XML  Format = "xml"
+)
+
+// Config describes one Booru instance. Instances are configured as a JSON
+// array in the BOORU_INSTANCES environment variable, e.g.
+//
+//	[{"name":"safebooru","flavor":"gelbooru","base_url":"https://safebooru.org","rating":"safe"}]
+type Config struct {
+	// Name is the registry key stored with subscriptions; it can't change
+	// once users have subscribed.
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Flavor      Flavor `json:"flavor"`
+	BaseURL     string `json:"base_url"`
+	// Format defaults to JSON. Some older sites only answer XML.
+	Format Format `json:"format"`
+	// Login and APIKey authenticate requests: login/api_key on Danbooru,
+	// user_id/api_key on Gelbooru and login/password_hash on Moebooru.
+	Login  string `json:"login"`
+	APIKey string `json:"api_key"`
+	// Rating is applied to every search that doesn't pick one, including
+	// feed subscriptions, e.g. "safe" or "-explicit".
+	Rating string `json:"rating"`
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ParseConfig parses the BOORU_INSTANCES value. An empty value configures no
+// instances.
+func ParseConfig(value string) ([]Config, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var configs []Config
+	if err := json.Unmarshal([]byte(value), &configs); err != nil {
+		return nil, fmt.Errorf("booru: invalid BOORU_INSTANCES: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range configs {
+		if err := configs[i].validate(); err != nil {
+			return nil, err
+		}
+		if seen[configs[i].Name] {
+			return nil, fmt.Errorf("booru: duplicate instance name %q", configs[i].Name)
+		}
+		seen[configs[i].Name] = true
+	}
+	return configs, nil
+}
+
+// validate checks c and fills in defaults.
+func (c *Config) validate() error {
+	if !validName.MatchString(c.Name) {
+		return fmt.Errorf("booru: invalid instance name %q", c.Name)
+	}
+	switch c.Flavor {
+	case Danbooru, Gelbooru, Moebooru:
+	default:
+		return fmt.Errorf("booru: %s: unknown flavor %q", c.Name, c.Flavor)
+	}
+	switch c.Format {
+	case "":
+		c.Format = JSON
+	case JSON, XML:
+	default:
+		return fmt.Errorf("booru: %s: unknown format %q", c.Name, c.Format)
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("booru: %s: invalid base_url %q", c.Name, c.BaseURL)
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	if c.DisplayName == "" {
+		c.DisplayName = c.Name
+	}
+	return nil
+}
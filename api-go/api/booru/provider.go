@@ -0,0 +1,92 @@
+package booru
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"strconv"
+	"strings"
+)
+
+// Provider adapts a BooruClient to api.MediaSearcher under the instance's
+// configured name. Booru sites tag artists rather than hosting creator
+// profiles, so only tag search, tag suggestions and single posts are
+// supported.
+type Provider struct {
+	client *BooruClient
+}
+
+var _ api.MediaSearcher = (*Provider)(nil)
+
+// NewProvider creates a provider for the instance described by config; opts
+// configure its client.
+func NewProvider(config Config, opts ...Option) *Provider {
+	return &Provider{client: NewClient(config, opts...)}
+}
+
+func (p *Provider) Name() string        { return p.client.config.Name }
+func (p *Provider) DisplayName() string { return p.client.config.DisplayName }
+
+func (p *Provider) Capabilities() api.Capabilities {
+	return api.Capabilities{
+		TagSearch:  true,
+		TagSuggest: true,
+		SingleItem: true,
+		Ratings:    true,
+	}
+}
+
+func (p *Provider) ParseTags(query string) []string {
+	return ParseTags(query)
+}
+
+func (p *Provider) SearchTerm(tags []string) string {
+	return strings.Join(tags, " ")
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	page := api.CursorPage(q.Cursor)
+	files, err := p.client.Search(ctx, q.Tags, q.Rating, q.Count, page)
+	if err != nil {
+		return api.Page{}, err
+	}
+	result := api.Page{Files: files}
+	if len(files) > 0 {
+		result.Next = api.PageCursor(page + 1)
+	}
+	return result, nil
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	// Negated tags are suggested like any other.
+	negate := strings.HasPrefix(query, "-")
+	tags, err := p.client.ListTags(ctx, strings.TrimPrefix(query, "-"), count)
+	if err != nil || !negate {
+		return tags, err
+	}
+	for i := range tags {
+		tags[i].Name = "-" + tags[i].Name
+	}
+	return tags, nil
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	return nil, "", api.ErrUnsupported
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	return nil, api.ErrUnsupported
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	return api.Page{}, api.ErrUnsupported
+}
+
+// GetItem accepts a bare post id or a feed video id ("<name>_<id>").
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	postID, err := strconv.ParseInt(strings.TrimPrefix(id, p.Name()+"_"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: invalid post id %q", p.Name(), api.ErrNotFound, id)
+	}
+	return p.client.GetPost(ctx, postID)
+}
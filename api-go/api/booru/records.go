@@ -0,0 +1,134 @@
+package booru
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// record is one post or tag flattened to strings. The Booru flavors disagree
+// on whether fields are JSON strings or numbers, XML attributes or child
+// elements, and snake_case or kebab-case; decoding into a flat map hides all
+// of that so the mapping code only deals with field names. Nested objects
+// are flattened with dots, e.g. "media_asset.duration".
+type record map[string]string
+
+// decodeRecords decodes a list of posts or tags. JSON lists may be bare
+// arrays or wrapped in an object under one of listKeys, as Gelbooru does.
+func decodeRecords(format Format, body []byte, listKeys ...string) ([]record, error) {
+	body = bytes.TrimSpace(body)
+	// Gelbooru-style APIs answer an empty result with an empty body.
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if format == XML {
+		return decodeXMLRecords(body)
+	}
+	return decodeJSONRecords(body, listKeys)
+}
+
+func decodeJSONRecords(body []byte, listKeys []string) ([]record, error) {
+	var items []map[string]json.RawMessage
+	if body[0] == '{' {
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(body, &wrapper); err != nil {
+			return nil, err
+		}
+		for _, key := range listKeys {
+			if list, ok := wrapper[key]; ok {
+				if err := json.Unmarshal(list, &items); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	} else if err := json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+
+	records := make([]record, 0, len(items))
+	for _, item := range items {
+		rec := record{}
+		flattenJSON(rec, "", item)
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func flattenJSON(rec record, prefix string, fields map[string]json.RawMessage) {
+	for key, raw := range fields {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		switch raw[0] {
+		case '"':
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				rec[prefix+key] = s
+			}
+		case '{':
+			var nested map[string]json.RawMessage
+			if json.Unmarshal(raw, &nested) == nil {
+				flattenJSON(rec, prefix+key+".", nested)
+			}
+		case '[', 'n':
+			// Arrays aren't needed by any mapping; null stays unset.
+		default:
+			rec[prefix+key] = string(raw)
+		}
+	}
+}
+
+// decodeXMLRecords treats every child of the root element as a record. Its
+// attributes and the text of its child elements become fields.
+func decodeXMLRecords(body []byte) ([]record, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var records []record
+	var rec record
+	var path []string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, xmlName(t.Name.Local))
+			switch len(path) {
+			case 2:
+				rec = record{}
+				for _, attr := range t.Attr {
+					rec[xmlName(attr.Name.Local)] = attr.Value
+				}
+			default:
+				text.Reset()
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			switch {
+			case len(path) == 2:
+				records = append(records, rec)
+			case len(path) > 2:
+				if value := strings.TrimSpace(text.String()); value != "" {
+					rec[strings.Join(path[2:], ".")] = value
+				}
+				text.Reset()
+			}
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// xmlName maps Danbooru's kebab-case element names to the JSON field names.
+func xmlName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
@@ -0,0 +1,182 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"kannonfoundry/api-go/api"
+	"sync"
+	"time"
+)
+
+// probeWait is the RetryAfter given to requests turned away while a
+// half-open circuit's probe is in flight.
+const probeWait = time.Second
+
+// State is where a circuit is in its cycle.
+type State int
+
+const (
+	// Closed lets every request through and counts upstream failures.
+	Closed State = iota
+	// Open fails every request without calling upstream.
+	Open
+	// HalfOpen lets a single probe through; its outcome closes or re-opens
+	// the circuit.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Settings controls when a circuit opens and for how long.
+type Settings struct {
+	// Failures is how many consecutive upstream failures open the circuit.
+	Failures int
+	// OpenFor is how long the circuit stays open before probing. It doubles
+	// each time a probe fails, up to MaxOpenFor.
+	OpenFor    time.Duration
+	MaxOpenFor time.Duration
+}
+
+// DefaultSettings gives up on a provider after a handful of failed calls
+// and checks on it every 30 seconds, backing off to 5 minutes.
+var DefaultSettings = Settings{
+	Failures:   5,
+	OpenFor:    30 * time.Second,
+	MaxOpenFor: 5 * time.Minute,
+}
+
+// Breaker tracks one provider's health. It is safe for concurrent use.
+type Breaker struct {
+	mu        sync.Mutex
+	settings  Settings
+	state     State
+	failures  int // consecutive, while closed
+	openFor   time.Duration
+	openUntil time.Time
+	probing   bool
+	changed   time.Time
+
+	opened, rejected int64
+}
+
+// New creates a closed breaker.
+func New(settings Settings) *Breaker {
+	return &Breaker{
+		settings: settings,
+		openFor:  settings.OpenFor,
+		changed:  time.Now(),
+	}
+}
+
+// Allow reports whether a request may go upstream. When it returns an error
+// (an *api.UnavailableError) the request must not be made; otherwise the
+// caller must pass the request's outcome to Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case Open:
+		if now.Before(b.openUntil) {
+			b.rejected++
+			return &api.UnavailableError{RetryAfter: b.openUntil.Sub(now)}
+		}
+		b.setState(HalfOpen, now)
+		b.probing = true
+	case HalfOpen:
+		if b.probing {
+			b.rejected++
+			return &api.UnavailableError{RetryAfter: probeWait}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Done records the outcome of a request Allow let through. Upstream
+// failures count against the circuit; any other answer from upstream,
+// including "not found", shows it is up. Cancellations and client-side rate
+// limiting say nothing either way.
+func (b *Breaker) Done(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	probe := b.state == HalfOpen
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case ctx.Err() != nil, errors.Is(err, api.ErrRateLimited):
+		return
+	case errors.Is(err, api.ErrUpstream):
+		if probe {
+			b.openFor = min(2*b.openFor, b.settings.MaxOpenFor)
+			b.open(now)
+			return
+		}
+		b.failures++
+		if b.state == Closed && b.failures >= b.settings.Failures {
+			b.open(now)
+		}
+	default:
+		b.failures = 0
+		if probe {
+			b.openFor = b.settings.OpenFor
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// open trips the circuit. Callers must hold b.mu.
+func (b *Breaker) open(now time.Time) {
+	b.opened++
+	b.failures = 0
+	b.openUntil = now.Add(b.openFor)
+	b.setState(Open, now)
+}
+
+// setState moves to state. Callers must hold b.mu.
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.changed = now
+}
+
+// Stats is a snapshot of a Breaker.
+type Stats struct {
+	State    State     `json:"state"`
+	Since    time.Time `json:"since"`
+	Failures int       `json:"consecutive_failures"`
+	// RetryAfterMs is how long an open circuit stays open.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+	Opened       int64 `json:"opened"`   // times the circuit has opened
+	Rejected     int64 `json:"rejected"` // requests failed without calling upstream
+}
+
+// Stats returns the breaker's state and counters.
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := Stats{
+		State:    b.state,
+		Since:    b.changed,
+		Failures: b.failures,
+		Opened:   b.opened,
+		Rejected: b.rejected,
+	}
+	if b.state == Open {
+		stats.RetryAfterMs = max(time.Until(b.openUntil), 0).Milliseconds()
+	}
+	return stats
+}
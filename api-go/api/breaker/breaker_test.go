@@ -0,0 +1,141 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"testing"
+	"time"
+)
+
+var (
+	upstreamErr = fmt.Errorf("test: %w", api.ErrUpstream)
+	notFoundErr = fmt.Errorf("test: %w", api.ErrNotFound)
+)
+
+var testSettings = Settings{Failures: 3, OpenFor: time.Minute, MaxOpenFor: 3 * time.Minute}
+
+// call runs one request through b that ends with err.
+func call(t *testing.T, b *Breaker, ctx context.Context, err error) {
+	t.Helper()
+	if allowErr := b.Allow(); allowErr != nil {
+		t.Fatalf("Allow: %v", allowErr)
+	}
+	b.Done(ctx, err)
+}
+
+// elapse ends b's open period as if OpenFor had passed.
+func elapse(b *Breaker) {
+	b.mu.Lock()
+	b.openUntil = time.Now()
+	b.mu.Unlock()
+}
+
+func wantState(t *testing.T, b *Breaker, want State) {
+	t.Helper()
+	if got := b.Stats().State; got != want {
+		t.Fatalf("state %s, want %s", got, want)
+	}
+}
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	b := New(testSettings)
+	ctx := context.Background()
+	call(t, b, ctx, upstreamErr)
+	call(t, b, ctx, upstreamErr)
+	// Any answer from upstream, even "not found", resets the count.
+	call(t, b, ctx, notFoundErr)
+	call(t, b, ctx, upstreamErr)
+	call(t, b, ctx, upstreamErr)
+	wantState(t, b, Closed)
+
+	call(t, b, ctx, upstreamErr)
+	wantState(t, b, Open)
+	err := b.Allow()
+	var unavailable *api.UnavailableError
+	if !errors.As(err, &unavailable) || !errors.Is(err, api.ErrSourceUnavailable) {
+		t.Fatalf("got %v, want an unavailable error", err)
+	}
+	if unavailable.RetryAfter <= 0 || unavailable.RetryAfter > time.Minute {
+		t.Errorf("retry after %s, want up to a minute", unavailable.RetryAfter)
+	}
+	if s := b.Stats(); s.Opened != 1 || s.Rejected != 1 {
+		t.Errorf("stats %+v, want opened once and 1 rejected", s)
+	}
+}
+
+func TestHalfOpenLetsOneProbeThrough(t *testing.T) {
+	b := New(testSettings)
+	ctx := context.Background()
+	for range 3 {
+		call(t, b, ctx, upstreamErr)
+	}
+	elapse(b)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	wantState(t, b, HalfOpen)
+	err := b.Allow()
+	if !errors.Is(err, api.ErrSourceUnavailable) || api.RetryAfter(err) != probeWait {
+		t.Fatalf("second request during the probe got %v", err)
+	}
+
+	b.Done(ctx, nil)
+	wantState(t, b, Closed)
+	call(t, b, ctx, nil)
+}
+
+func TestFailedProbesBackOff(t *testing.T) {
+	b := New(testSettings)
+	ctx := context.Background()
+	for range 3 {
+		call(t, b, ctx, upstreamErr)
+	}
+
+	// Each failed probe doubles the open period, up to MaxOpenFor.
+	for _, want := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		elapse(b)
+		call(t, b, ctx, upstreamErr)
+		wantState(t, b, Open)
+		if got := api.RetryAfter(b.Allow()); got <= want-time.Second || got > want {
+			t.Errorf("open for %s, want %s", got, want)
+		}
+	}
+
+	// A successful probe starts over from OpenFor.
+	elapse(b)
+	call(t, b, ctx, nil)
+	for range 3 {
+		call(t, b, ctx, upstreamErr)
+	}
+	if got := api.RetryAfter(b.Allow()); got <= 59*time.Second || got > time.Minute {
+		t.Errorf("open for %s after recovering, want 1m", got)
+	}
+}
+
+func TestNeutralOutcomes(t *testing.T) {
+	b := New(Settings{Failures: 1, OpenFor: time.Minute, MaxOpenFor: time.Minute})
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := context.Background()
+
+	// Neither our own rate limiting nor a caller giving up says anything
+	// about upstream.
+	call(t, b, ctx, &api.RateLimitError{})
+	call(t, b, cancelled, upstreamErr)
+	wantState(t, b, Closed)
+
+	call(t, b, ctx, upstreamErr)
+	wantState(t, b, Open)
+	elapse(b)
+
+	// A neutral probe leaves the circuit half-open for the next one.
+	call(t, b, cancelled, upstreamErr)
+	wantState(t, b, HalfOpen)
+	call(t, b, ctx, &api.RateLimitError{RetryAfter: time.Second})
+	wantState(t, b, HalfOpen)
+	call(t, b, ctx, nil)
+	wantState(t, b, Closed)
+}
@@ -0,0 +1,99 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+)
+
+// Provider fails calls to another provider straight away while its circuit
+// is open. Name, display name, capabilities and tag parsing pass straight
+// through.
+type Provider struct {
+	api.MediaSearcher
+	breaker *Breaker
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.FolderSource  = (*Provider)(nil)
+	_ api.Wrapper       = (*Provider)(nil)
+	_ api.StatsReporter = (*Provider)(nil)
+)
+
+// Wrap puts provider behind a circuit breaker with settings.
+func Wrap(provider api.MediaSearcher, settings Settings) *Provider {
+	return &Provider{MediaSearcher: provider, breaker: New(settings)}
+}
+
+// Unwrap returns the guarded provider.
+func (p *Provider) Unwrap() api.MediaSearcher {
+	return p.MediaSearcher
+}
+
+// guard calls fn unless the circuit is open, and records its outcome.
+func guard[V any](ctx context.Context, p *Provider, fn func() (V, error)) (V, error) {
+	if err := p.breaker.Allow(); err != nil {
+		var zero V
+		return zero, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	value, err := fn()
+	p.breaker.Done(ctx, err)
+	return value, err
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	return guard(ctx, p, func() (api.Page, error) {
+		return p.MediaSearcher.SearchTags(ctx, q)
+	})
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	return guard(ctx, p, func() ([]api.Tag, error) {
+		return p.MediaSearcher.SuggestTags(ctx, query, count)
+	})
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	var next string
+	creators, err := guard(ctx, p, func() ([]api.Creator, error) {
+		creators, cursor, err := p.MediaSearcher.SearchCreators(ctx, query, count, cursor)
+		next = cursor
+		return creators, err
+	})
+	return creators, next, err
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	return guard(ctx, p, func() (*api.Creator, error) {
+		return p.MediaSearcher.GetCreator(ctx, username)
+	})
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	return guard(ctx, p, func() (api.Page, error) {
+		return p.MediaSearcher.CreatorItems(ctx, username, count, cursor)
+	})
+}
+
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	return guard(ctx, p, func() (*api.FileToSend, error) {
+		return p.MediaSearcher.GetItem(ctx, id)
+	})
+}
+
+// FolderItems guards folder listings when the wrapped provider has folders.
+func (p *Provider) FolderItems(ctx context.Context, folder string, count int, cursor string) (api.Page, error) {
+	folders, ok := p.MediaSearcher.(api.FolderSource)
+	if !ok {
+		return api.Page{}, fmt.Errorf("%s: %w: folders", p.Name(), api.ErrUnsupported)
+	}
+	return guard(ctx, p, func() (api.Page, error) {
+		return folders.FolderItems(ctx, folder, count, cursor)
+	})
+}
+
+// Stats reports the circuit's state.
+func (p *Provider) Stats() map[string]any {
+	return map[string]any{"circuit": p.breaker.Stats()}
+}
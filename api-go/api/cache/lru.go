@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"kannonfoundry/api-go/api"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// refreshTimeout bounds a background revalidation, which outlives the
+// request that triggered it.
+const refreshTimeout = 30 * time.Second
+
+// LRU is a size-bounded cache whose entries are fresh for a TTL and may then
+// be served stale for a further grace period while they are refreshed in the
+// background. It is safe for concurrent use.
+type LRU[V any] struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+
+	hits, staleHits, misses, errors atomic.Int64
+}
+
+type entry[V any] struct {
+	key        string
+	value      V
+	freshUntil time.Time
+	staleUntil time.Time
+	refreshing bool
+}
+
+// NewLRU creates a cache holding at most max entries.
+func NewLRU[V any](max int) *LRU[V] {
+	return &LRU[V]{
+		max:     max,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Fetch returns the cached value for key, calling fetch on a miss. Fresh
+// entries are returned as is. Stale ones are returned too, and one
+// background call to fetch replaces them; if that call fails the stale value
+// keeps being served until its grace period ends. Errors are not cached.
+func (c *LRU[V]) Fetch(ctx context.Context, key string, ttl, stale time.Duration, fetch func(context.Context) (V, error)) (V, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[V])
+		if now.Before(e.freshUntil) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.value, nil
+		}
+		if now.Before(e.staleUntil) {
+			c.order.MoveToFront(el)
+			if !e.refreshing {
+				e.refreshing = true
+				// The caller already has a value, so the refresh can
+				// wait behind interactive requests upstream.
+				go c.refresh(api.WithBackground(context.WithoutCancel(ctx)), key, ttl, stale, fetch)
+			}
+			c.mu.Unlock()
+			c.staleHits.Add(1)
+			return e.value, nil
+		}
+		c.remove(el)
+	}
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	value, err := fetch(ctx)
+	if err != nil {
+		c.errors.Add(1)
+		return value, err
+	}
+	c.set(key, value, ttl, stale)
+	return value, nil
+}
+
+func (c *LRU[V]) refresh(ctx context.Context, key string, ttl, stale time.Duration, fetch func(context.Context) (V, error)) {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+	value, err := fetch(ctx)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("Cache refresh of %s failed, serving stale: %v", key, err)
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			el.Value.(*entry[V]).refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.set(key, value, ttl, stale)
+}
+
+func (c *LRU[V]) set(key string, value V, ttl, stale time.Duration) {
+	now := time.Now()
+	e := &entry[V]{
+		key:        key,
+		value:      value,
+		freshUntil: now.Add(ttl),
+		staleUntil: now.Add(ttl + stale),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops el. Callers must hold c.mu.
+func (c *LRU[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[V]).key)
+}
+
+// Stats is a snapshot of a cache's counters.
+type Stats struct {
+	Entries   int   `json:"entries"`
+	Hits      int64 `json:"hits"`
+	StaleHits int64 `json:"stale_hits"`
+	Misses    int64 `json:"misses"`
+	Errors    int64 `json:"errors"`
+}
+
+// Stats returns the cache's size and counters.
+func (c *LRU[V]) Stats() Stats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+	return Stats{
+		Entries:   entries,
+		Hits:      c.hits.Load(),
+		StaleHits: c.staleHits.Load(),
+		Misses:    c.misses.Load(),
+		Errors:    c.errors.Load(),
+	}
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter is a fetch func returning value and counting its calls.
+func counter(calls *atomic.Int32, value string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		calls.Add(1)
+		return value, nil
+	}
+}
+
+func TestFetchCaches(t *testing.T) {
+	c := NewLRU[string](10)
+	ctx := context.Background()
+	var calls atomic.Int32
+	for range 3 {
+		v, err := c.Fetch(ctx, "k", time.Hour, 0, counter(&calls, "v"))
+		if err != nil || v != "v" {
+			t.Fatalf("got %q, %v", v, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 || s.Entries != 1 {
+		t.Errorf("stats %+v, want 2 hits, 1 miss, 1 entry", s)
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	c := NewLRU[string](10)
+	ctx := context.Background()
+	fail := errors.New("upstream down")
+	var calls atomic.Int32
+	for range 2 {
+		_, err := c.Fetch(ctx, "k", time.Hour, time.Hour, func(context.Context) (string, error) {
+			calls.Add(1)
+			return "", fail
+		})
+		if !errors.Is(err, fail) {
+			t.Fatalf("got %v, want %v", err, fail)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+	if s := c.Stats(); s.Errors != 2 || s.Entries != 0 {
+		t.Errorf("stats %+v, want 2 errors, no entries", s)
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[string](2)
+	ctx := context.Background()
+	var calls atomic.Int32
+	c.Fetch(ctx, "a", time.Hour, 0, counter(&calls, "a"))
+	c.Fetch(ctx, "b", time.Hour, 0, counter(&calls, "b"))
+	c.Fetch(ctx, "a", time.Hour, 0, counter(&calls, "a")) // a is now newer than b
+	c.Fetch(ctx, "c", time.Hour, 0, counter(&calls, "c")) // evicts b
+
+	calls.Store(0)
+	c.Fetch(ctx, "a", time.Hour, 0, counter(&calls, "a"))
+	if got := calls.Load(); got != 0 {
+		t.Error("a was evicted")
+	}
+	c.Fetch(ctx, "b", time.Hour, 0, counter(&calls, "b"))
+	if got := calls.Load(); got != 1 {
+		t.Error("b was kept")
+	}
+}
+
+// staleEntry caches "old" for key and waits until it is stale.
+func staleEntry(t *testing.T, c *LRU[string], key string, stale time.Duration) {
+	t.Helper()
+	var calls atomic.Int32
+	if _, err := c.Fetch(context.Background(), key, time.Millisecond, stale, counter(&calls, "old")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c := NewLRU[string](10)
+	staleEntry(t, c, "k", time.Hour)
+
+	var refreshes atomic.Int32
+	release := make(chan struct{})
+	refresh := func(ctx context.Context) (string, error) {
+		refreshes.Add(1)
+		<-release
+		return "new", nil
+	}
+
+	// Every caller gets the stale value at once while a single refresh runs.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Fetch(context.Background(), "k", time.Hour, time.Hour, refresh)
+			if err != nil || v != "old" {
+				t.Errorf("got %q, %v; want the stale value", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		v, _ := c.Fetch(context.Background(), "k", time.Hour, time.Hour, refresh)
+		if v == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed value never replaced the stale one")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Errorf("refreshed %d times, want 1", got)
+	}
+}
+
+func TestStaleKeptWhenRefreshFails(t *testing.T) {
+	c := NewLRU[string](10)
+	staleEntry(t, c, "k", time.Hour)
+
+	var refreshes atomic.Int32
+	refresh := func(ctx context.Context) (string, error) {
+		refreshes.Add(1)
+		return "", errors.New("upstream down")
+	}
+
+	// The stale value keeps being served, and once a refresh has failed the
+	// next stale hit tries again.
+	deadline := time.Now().Add(time.Second)
+	for refreshes.Load() < 2 {
+		v, err := c.Fetch(context.Background(), "k", time.Hour, time.Hour, refresh)
+		if err != nil || v != "old" {
+			t.Fatalf("got %q, %v; want the stale value", v, err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed refresh was never retried")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := c.Stats(); s.Entries != 1 || s.Misses != 1 {
+		t.Errorf("stats %+v, want 1 entry from 1 miss", s)
+	}
+}
+
+func TestExpiredRefetches(t *testing.T) {
+	c := NewLRU[string](10)
+	staleEntry(t, c, "k", time.Millisecond)
+
+	var calls atomic.Int32
+	v, err := c.Fetch(context.Background(), "k", time.Hour, 0, counter(&calls, "new"))
+	if err != nil || v != "new" {
+		t.Fatalf("got %q, %v; want the fetched value", v, err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"slices"
+	"time"
+)
+
+// Policy sets how long each kind of response stays fresh, how long it may
+// then be served stale while being refreshed, and how many are kept.
+type Policy struct {
+	LatestSearch   time.Duration // tag searches ordered by newest
+	RankedSearch   time.Duration // tag searches with any other order
+	Suggestions    time.Duration
+	CreatorSearch  time.Duration
+	CreatorProfile time.Duration
+	CreatorItems   time.Duration
+	Item           time.Duration
+	FolderItems    time.Duration
+
+	// Stale is the grace period after the TTL, as a multiple of it.
+	Stale int
+
+	MaxSearches int
+	MaxCreators int
+	MaxItems    int
+}
+
+// DefaultPolicy keeps listings briefly, since new uploads should show up
+// quickly, and profiles and single items for hours.
+var DefaultPolicy = Policy{
+	LatestSearch:   time.Minute,
+	RankedSearch:   10 * time.Minute,
+	Suggestions:    time.Hour,
+	CreatorSearch:  10 * time.Minute,
+	CreatorProfile: 6 * time.Hour,
+	CreatorItems:   time.Minute,
+	Item:           6 * time.Hour,
+	FolderItems:    time.Minute,
+
+	Stale: 4,
+
+	MaxSearches: 500,
+	MaxCreators: 1000,
+	MaxItems:    2000,
+}
+
+type creatorsPage struct {
+	creators []api.Creator
+	next     string
+}
+
+// Provider caches another provider's responses in memory. Name, display
+// name, capabilities and tag parsing pass straight through.
+type Provider struct {
+	api.MediaSearcher
+	policy Policy
+
+	searches        *LRU[api.Page]
+	suggestions     *LRU[[]api.Tag]
+	creatorSearches *LRU[creatorsPage]
+	creators        *LRU[api.Creator]
+	items           *LRU[api.FileToSend]
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.FolderSource  = (*Provider)(nil)
+	_ api.Wrapper       = (*Provider)(nil)
+	_ api.StatsReporter = (*Provider)(nil)
+)
+
+// Wrap caches provider's responses according to policy.
+func Wrap(provider api.MediaSearcher, policy Policy) *Provider {
+	return &Provider{
+		MediaSearcher:   provider,
+		policy:          policy,
+		searches:        NewLRU[api.Page](policy.MaxSearches),
+		suggestions:     NewLRU[[]api.Tag](policy.MaxSearches),
+		creatorSearches: NewLRU[creatorsPage](policy.MaxSearches),
+		creators:        NewLRU[api.Creator](policy.MaxCreators),
+		items:           NewLRU[api.FileToSend](policy.MaxItems),
+	}
+}
+
+// Unwrap returns the cached provider.
+func (p *Provider) Unwrap() api.MediaSearcher {
+	return p.MediaSearcher
+}
+
+func (p *Provider) stale(ttl time.Duration) time.Duration {
+	return ttl * time.Duration(p.policy.Stale)
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	// Providers without sort orders always list newest first.
+	ttl := p.policy.RankedSearch
+	if q.Order == "" || q.Order == "latest" {
+		ttl = p.policy.LatestSearch
+	}
+	key := fmt.Sprintf("tags %#v", q)
+	page, err := p.searches.Fetch(ctx, key, ttl, p.stale(ttl), func(ctx context.Context) (api.Page, error) {
+		return p.MediaSearcher.SearchTags(ctx, q)
+	})
+	return clonePage(page), err
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	key := fmt.Sprintf("suggest %q %d", query, count)
+	ttl := p.policy.Suggestions
+	tags, err := p.suggestions.Fetch(ctx, key, ttl, p.stale(ttl), func(ctx context.Context) ([]api.Tag, error) {
+		return p.MediaSearcher.SuggestTags(ctx, query, count)
+	})
+	return slices.Clone(tags), err
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	key := fmt.Sprintf("creators %q %d %q", query, count, cursor)
+	ttl := p.policy.CreatorSearch
+	page, err := p.creatorSearches.Fetch(ctx, key, ttl, p.stale(ttl), func(ctx context.Context) (creatorsPage, error) {
+		creators, next, err := p.MediaSearcher.SearchCreators(ctx, query, count, cursor)
+		return creatorsPage{creators: creators, next: next}, err
+	})
+	return slices.Clone(page.creators), page.next, err
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	ttl := p.policy.CreatorProfile
+	creator, err := p.creators.Fetch(ctx, "creator "+username, ttl, p.stale(ttl), func(ctx context.Context) (api.Creator, error) {
+		creator, err := p.MediaSearcher.GetCreator(ctx, username)
+		if err != nil {
+			return api.Creator{}, err
+		}
+		return *creator, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &creator, nil
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	key := fmt.Sprintf("creator items %q %d %q", username, count, cursor)
+	ttl := p.policy.CreatorItems
+	page, err := p.searches.Fetch(ctx, key, ttl, p.stale(ttl), func(ctx context.Context) (api.Page, error) {
+		return p.MediaSearcher.CreatorItems(ctx, username, count, cursor)
+	})
+	return clonePage(page), err
+}
+
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	ttl := p.policy.Item
+	file, err := p.items.Fetch(ctx, "item "+id, ttl, p.stale(ttl), func(ctx context.Context) (api.FileToSend, error) {
+		file, err := p.MediaSearcher.GetItem(ctx, id)
+		if err != nil {
+			return api.FileToSend{}, err
+		}
+		return *file, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FolderItems caches folder listings when the wrapped provider has folders.
+func (p *Provider) FolderItems(ctx context.Context, folder string, count int, cursor string) (api.Page, error) {
+	folders, ok := p.MediaSearcher.(api.FolderSource)
+	if !ok {
+		return api.Page{}, fmt.Errorf("%s: %w: folders", p.Name(), api.ErrUnsupported)
+	}
+	key := fmt.Sprintf("folder %q %d %q", folder, count, cursor)
+	ttl := p.policy.FolderItems
+	page, err := p.searches.Fetch(ctx, key, ttl, p.stale(ttl), func(ctx context.Context) (api.Page, error) {
+		return folders.FolderItems(ctx, folder, count, cursor)
+	})
+	return clonePage(page), err
+}
+
+// Stats returns the counters of each of the provider's caches.
+func (p *Provider) Stats() map[string]any {
+	return map[string]any{
+		"cache": map[string]Stats{
+			"searches":         p.searches.Stats(),
+			"suggestions":      p.suggestions.Stats(),
+			"creator_searches": p.creatorSearches.Stats(),
+			"creators":         p.creators.Stats(),
+			"items":            p.items.Stats(),
+		},
+	}
+}
+
+// clonePage copies page's files so callers rewriting URLs in place don't
+// change the cached copy.
+func clonePage(page api.Page) api.Page {
+	page.Files = slices.Clone(page.Files)
+	return page
+}
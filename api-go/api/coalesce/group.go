@@ -0,0 +1,98 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Group runs at most one call per key at a time; callers arriving while a
+// call is in flight wait for it and share its result. It is safe for
+// concurrent use.
+type Group[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[V]
+
+	requests, upstream atomic.Int64
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do returns the result of fn, or of the identical call already in flight.
+// fn runs detached from any one caller's cancellation: a caller giving up
+// only stops waiting, and fn is cancelled once every caller has given up.
+func (g *Group[V]) Do(ctx context.Context, key string, fn func(context.Context) (V, error)) (V, error) {
+	g.requests.Add(1)
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call[V]{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		g.upstream.Add(1)
+		go func() {
+			c.value, c.err = fn(callCtx)
+			g.mu.Lock()
+			g.forget(key, c)
+			g.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// forget removes c if it is still the call in flight for key. Callers must
+// hold g.mu.
+func (g *Group[V]) forget(key string, c *call[V]) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// Stats counts calls into a Group.
+type Stats struct {
+	Requests int64 `json:"requests"`
+	Upstream int64 `json:"upstream"`
+	Saved    int64 `json:"saved"` // requests that shared another call's result
+	InFlight int   `json:"in_flight"`
+}
+
+// Stats returns the group's counters.
+func (g *Group[V]) Stats() Stats {
+	g.mu.Lock()
+	inFlight := len(g.calls)
+	g.mu.Unlock()
+	requests, upstream := g.requests.Load(), g.upstream.Load()
+	return Stats{
+		Requests: requests,
+		Upstream: upstream,
+		Saved:    requests - upstream,
+		InFlight: inFlight,
+	}
+}
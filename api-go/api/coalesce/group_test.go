@@ -0,0 +1,150 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// joined waits until n calls have entered g.Do, plus a moment for the last
+// of them to register as a waiter.
+func joined[V any](t *testing.T, g *Group[V], n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for g.Stats().Requests < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d callers", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestDoShares(t *testing.T) {
+	var g Group[string]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Do(context.Background(), "k", fn); err != nil || v != "v" {
+				t.Errorf("got %q, %v", v, err)
+			}
+		}()
+	}
+	joined(t, &g, 5)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("called %d times, want 1", got)
+	}
+	want := Stats{Requests: 5, Upstream: 1, Saved: 4}
+	if s := g.Stats(); s != want {
+		t.Errorf("stats %+v, want %+v", s, want)
+	}
+
+	// Once the call has finished, the next one runs again.
+	g.Do(context.Background(), "k", fn)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("called %d times after the first call finished, want 2", got)
+	}
+}
+
+func TestDoSharesErrors(t *testing.T) {
+	var g Group[string]
+	fail := errors.New("upstream down")
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		<-release
+		return "", fail
+	}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := g.Do(context.Background(), "k", fn)
+			errs <- err
+		}()
+	}
+	joined(t, &g, 2)
+	close(release)
+	for range 2 {
+		if err := <-errs; !errors.Is(err, fail) {
+			t.Errorf("got %v, want %v", err, fail)
+		}
+	}
+}
+
+func TestDoKeysSeparate(t *testing.T) {
+	var g Group[string]
+	for _, key := range []string{"a", "b"} {
+		v, _ := g.Do(context.Background(), key, func(context.Context) (string, error) { return key, nil })
+		if v != key {
+			t.Errorf("Do(%q) = %q", key, v)
+		}
+	}
+	if s := g.Stats(); s.Upstream != 2 || s.Saved != 0 {
+		t.Errorf("stats %+v, want 2 upstream calls", s)
+	}
+}
+
+func TestCancelledOnlyWhenEveryCallerLeaves(t *testing.T) {
+	var g Group[string]
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.Do(first, "k", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.Do(second, "k", fn)
+		errs <- err
+	}()
+	joined(t, &g, 2)
+
+	cancelFirst()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first caller got %v, want canceled", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("call cancelled while a caller was still waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("second caller got %v, want canceled", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call not cancelled after every caller left")
+	}
+	if s := g.Stats(); s.InFlight != 0 {
+		t.Errorf("%d calls still in flight", s.InFlight)
+	}
+}
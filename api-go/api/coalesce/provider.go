@@ -0,0 +1,132 @@
+package coalesce
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"slices"
+)
+
+type creatorsPage struct {
+	creators []api.Creator
+	next     string
+}
+
+// Provider shares identical concurrent calls to another provider, keyed by
+// method and arguments. Name, display name, capabilities and tag parsing
+// pass straight through.
+type Provider struct {
+	api.MediaSearcher
+
+	searches        Group[api.Page]
+	suggestions     Group[[]api.Tag]
+	creatorSearches Group[creatorsPage]
+	creators        Group[*api.Creator]
+	creatorItems    Group[api.Page]
+	items           Group[*api.FileToSend]
+	folderItems     Group[api.Page]
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.FolderSource  = (*Provider)(nil)
+	_ api.Wrapper       = (*Provider)(nil)
+	_ api.StatsReporter = (*Provider)(nil)
+)
+
+// Wrap coalesces calls to provider.
+func Wrap(provider api.MediaSearcher) *Provider {
+	return &Provider{MediaSearcher: provider}
+}
+
+// Unwrap returns the wrapped provider.
+func (p *Provider) Unwrap() api.MediaSearcher {
+	return p.MediaSearcher
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	page, err := p.searches.Do(ctx, fmt.Sprintf("%#v", q), func(ctx context.Context) (api.Page, error) {
+		return p.MediaSearcher.SearchTags(ctx, q)
+	})
+	return clonePage(page), err
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	tags, err := p.suggestions.Do(ctx, fmt.Sprintf("%q %d", query, count), func(ctx context.Context) ([]api.Tag, error) {
+		return p.MediaSearcher.SuggestTags(ctx, query, count)
+	})
+	return slices.Clone(tags), err
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	page, err := p.creatorSearches.Do(ctx, fmt.Sprintf("%q %d %q", query, count, cursor), func(ctx context.Context) (creatorsPage, error) {
+		creators, next, err := p.MediaSearcher.SearchCreators(ctx, query, count, cursor)
+		return creatorsPage{creators: creators, next: next}, err
+	})
+	return slices.Clone(page.creators), page.next, err
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	creator, err := p.creators.Do(ctx, username, func(ctx context.Context) (*api.Creator, error) {
+		return p.MediaSearcher.GetCreator(ctx, username)
+	})
+	if creator == nil {
+		return nil, err
+	}
+	copied := *creator
+	return &copied, err
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	page, err := p.creatorItems.Do(ctx, fmt.Sprintf("%q %d %q", username, count, cursor), func(ctx context.Context) (api.Page, error) {
+		return p.MediaSearcher.CreatorItems(ctx, username, count, cursor)
+	})
+	return clonePage(page), err
+}
+
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	file, err := p.items.Do(ctx, id, func(ctx context.Context) (*api.FileToSend, error) {
+		return p.MediaSearcher.GetItem(ctx, id)
+	})
+	if file == nil {
+		return nil, err
+	}
+	copied := *file
+	return &copied, err
+}
+
+// FolderItems coalesces folder listings when the wrapped provider has
+// folders.
+func (p *Provider) FolderItems(ctx context.Context, folder string, count int, cursor string) (api.Page, error) {
+	folders, ok := p.MediaSearcher.(api.FolderSource)
+	if !ok {
+		return api.Page{}, fmt.Errorf("%s: %w: folders", p.Name(), api.ErrUnsupported)
+	}
+	page, err := p.folderItems.Do(ctx, fmt.Sprintf("%q %d %q", folder, count, cursor), func(ctx context.Context) (api.Page, error) {
+		return folders.FolderItems(ctx, folder, count, cursor)
+	})
+	return clonePage(page), err
+}
+
+// Stats reports, per method, how many calls were made and how many were
+// saved by sharing an in-flight call.
+func (p *Provider) Stats() map[string]any {
+	return map[string]any{
+		"coalescing": map[string]Stats{
+			"search_tags":     p.searches.Stats(),
+			"suggest_tags":    p.suggestions.Stats(),
+			"search_creators": p.creatorSearches.Stats(),
+			"get_creator":     p.creators.Stats(),
+			"creator_items":   p.creatorItems.Stats(),
+			"get_item":        p.items.Stats(),
+			"folder_items":    p.folderItems.Stats(),
+		},
+	}
+}
+
+// clonePage copies page's files so callers sharing a result can rewrite URLs
+// in place independently.
+func clonePage(page api.Page) api.Page {
+	page.Files = slices.Clone(page.Files)
+	return page
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested user or item doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when a provider rejects our credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited matches any *RateLimitError.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUpstream is returned for 5xx responses and network failures.
+	ErrUpstream = errors.New("upstream unavailable")
+	// ErrUnsupported is returned by providers for methods their Capabilities
+	// don't include.
+	ErrUnsupported = errors.New("not supported by this provider")
+	// ErrUnknownProvider is returned when a name isn't in the registry.
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrSourceUnavailable matches any *UnavailableError.
+	ErrSourceUnavailable = errors.New("source temporarily unavailable")
+)
+
+// RateLimitError is returned for a 429 that outlasted retries. RetryAfter is
+// zero when the provider didn't say how long to wait.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s (retry after %s)", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// UnavailableError is returned without calling upstream while a provider's
+// circuit breaker is open. RetryAfter is how long until it lets a request
+// through again.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrSourceUnavailable, e.RetryAfter)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrSourceUnavailable
+}
+
+// RetryAfter returns how long err says to wait before trying again, or zero.
+func RetryAfter(err error) time.Duration {
+	var rateLimited *RateLimitError
+	if errors.As(err, &rateLimited) {
+		return rateLimited.RetryAfter
+	}
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		return unavailable.RetryAfter
+	}
+	return 0
+}
+
+// HTTPStatus returns the status a handler should answer with for err.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnknownProvider):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrSourceUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrUnsupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,237 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultDir is the media directory main.go already serves at /files/.
+	DefaultDir = "files"
+	// DefaultURLPrefix is where the media directory is served.
+	DefaultURLPrefix = "/files/"
+)
+
+// Library indexes a directory of media files in the library_items table and
+// searches that index. Provider adapts it to api.MediaSearcher.
+type Library struct {
+	db        *pgxpool.Pool
+	dir       string
+	urlPrefix string
+}
+
+// Option configures a Library.
+type Option func(*Library)
+
+// WithURLPrefix sets the URL the media directory is served under.
+func WithURLPrefix(prefix string) Option {
+	return func(l *Library) {
+		l.urlPrefix = strings.TrimRight(prefix, "/") + "/"
+	}
+}
+
+// New creates a library over dir, indexed in db.
+func New(db *pgxpool.Pool, dir string, opts ...Option) *Library {
+	l := &Library{
+		db:        db,
+		dir:       dir,
+		urlPrefix: DefaultURLPrefix,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Item is an indexed media file. Path and Folder are slash-separated and
+// relative to the library directory; the root folder is "".
+type Item struct {
+	Id       int64
+	Path     string
+	Folder   string
+	Size     int64
+	ModTime  time.Time
+	Duration float64
+	Tags     []string
+	IsImage  bool
+}
+
+const itemColumns = `id, path, folder, size, mod_time, duration, tags, is_image`
+
+func scanItems(rows pgx.Rows) ([]Item, error) {
+	defer rows.Close()
+	var items []Item
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Id, &item.Path, &item.Folder, &item.Size, &item.ModTime,
+			&item.Duration, &item.Tags, &item.IsImage); err != nil {
+			return nil, fmt.Errorf("failed to scan library item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Search returns page (1-based) of items carrying every tag, newest first.
+// A tag that isn't indexed also matches file paths containing it, and tags
+// with a leading "-" exclude items carrying them.
+func (l *Library) Search(ctx context.Context, tags []string, count int, page int) ([]Item, error) {
+	// Empty rather than nil: pgx sends a nil slice as NULL, and
+	// "NOT tags && NULL" matches nothing.
+	include, exclude := []string{}, []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if negated, ok := strings.CutPrefix(tag, "-"); ok {
+			if negated != "" {
+				exclude = append(exclude, negated)
+			}
+		} else {
+			include = append(include, tag)
+		}
+	}
+
+	query := `
+		SELECT ` + itemColumns + `
+		FROM library_items
+		WHERE COALESCE((
+			SELECT bool_and(t = ANY(tags) OR strpos(lower(path), t) > 0)
+			FROM unnest($1::text[]) AS t
+		), true)
+		AND NOT tags && $2::text[]
+		ORDER BY mod_time DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := l.db.Query(ctx, query, include, exclude, count, (page-1)*count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search library: %w", err)
+	}
+	return scanItems(rows)
+}
+
+// FolderItems returns page (1-based) of the items in folder and below it,
+// newest first.
+func (l *Library) FolderItems(ctx context.Context, folder string, count int, page int) ([]Item, error) {
+	folder = CleanFolder(folder)
+	query := `
+		SELECT ` + itemColumns + `
+		FROM library_items
+		WHERE $1 = '' OR folder = $1 OR starts_with(folder, $1 || '/')
+		ORDER BY mod_time DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := l.db.Query(ctx, query, folder, count, (page-1)*count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library folder: %w", err)
+	}
+	return scanItems(rows)
+}
+
+// Subfolders returns the folders directly inside folder that contain media.
+func (l *Library) Subfolders(ctx context.Context, folder string) ([]string, error) {
+	folder = CleanFolder(folder)
+	prefix := ""
+	if folder != "" {
+		prefix = folder + "/"
+	}
+	query := `
+		SELECT DISTINCT split_part(substr(folder, length($1) + 1), '/', 1)
+		FROM library_items
+		WHERE starts_with(folder, $1) AND length(folder) > length($1)
+		ORDER BY 1
+	`
+	rows, err := l.db.Query(ctx, query, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library subfolders: %w", err)
+	}
+	defer rows.Close()
+	var folders []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan library subfolder: %w", err)
+		}
+		folders = append(folders, prefix+name)
+	}
+	return folders, rows.Err()
+}
+
+// Get returns the item with id.
+func (l *Library) Get(ctx context.Context, id int64) (*Item, error) {
+	rows, err := l.db.Query(ctx, `SELECT `+itemColumns+` FROM library_items WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get library item: %w", err)
+	}
+	items, err := scanItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("library: %w: item %d", api.ErrNotFound, id)
+	}
+	return &items[0], nil
+}
+
+// SuggestTags returns up to count indexed tags starting with prefix, most
+// used first.
+func (l *Library) SuggestTags(ctx context.Context, prefix string, count int) ([]api.Tag, error) {
+	query := `
+		SELECT tag, COUNT(*)
+		FROM library_items, unnest(tags) AS tag
+		WHERE starts_with(tag, $1)
+		GROUP BY tag
+		ORDER BY COUNT(*) DESC, tag
+		LIMIT $2
+	`
+	rows, err := l.db.Query(ctx, query, strings.ToLower(prefix), count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest library tags: %w", err)
+	}
+	defer rows.Close()
+	var tags []api.Tag
+	for rows.Next() {
+		var tag api.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan library tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// URL returns where item is served.
+func (l *Library) URL(item Item) string {
+	segments := strings.Split(item.Path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return l.urlPrefix + strings.Join(segments, "/")
+}
+
+// CleanFolder normalises a folder from a URL or subscription to the form
+// stored in library_items: slash-separated, relative, "" for the root.
+func CleanFolder(folder string) string {
+	return strings.Trim(path.Clean("/"+folder), "/")
+}
+
+func (l *Library) toFileToSend(item Item) api.FileToSend {
+	u := l.URL(item)
+	return api.FileToSend{
+		Name:      itemPrefix + strconv.FormatInt(item.Id, 10),
+		Provider:  ProviderName,
+		URL:       u,
+		CreatedAt: item.ModTime.Unix(),
+		HDURL:     u,
+		Tags:      item.Tags,
+		Duration:  item.Duration,
+		IsImage:   item.IsImage,
+	}
+}
@@ -0,0 +1,132 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB connects to TEST_DATABASE_URL and applies db/migrations.sql in a
+// schema of its own, dropped when the test ends.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("library_test_%d", time.Now().UnixNano())
+
+	admin, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrations, err := os.ReadFile("../../db/migrations.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, string(migrations)); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return pool
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func paths(items []Item) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.Path)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestScanAndSearch(t *testing.T) {
+	pool := testDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.jpg"), "a")
+	writeFile(t, filepath.Join(dir, "a.txt"), "cat, outdoor")
+	writeFile(t, filepath.Join(dir, "pets", "b.jpg"), "b")
+	writeFile(t, filepath.Join(dir, "pets", "b.txt"), "cat")
+	writeFile(t, filepath.Join(dir, "c.png"), "c")
+
+	l := New(pool, dir)
+	stats, err := l.Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Indexed != 3 {
+		t.Fatalf("indexed %d files, want 3", stats.Indexed)
+	}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{"a.jpg", "c.png", "pets/b.jpg"}},
+		{[]string{"cat"}, []string{"a.jpg", "pets/b.jpg"}},
+		{[]string{"-outdoor"}, []string{"c.png", "pets/b.jpg"}},
+		{[]string{"cat", "-outdoor"}, []string{"pets/b.jpg"}},
+		{[]string{"pets"}, []string{"pets/b.jpg"}},
+		// Path matches are literal, not LIKE patterns.
+		{[]string{"_"}, nil},
+		{[]string{"%"}, nil},
+	}
+	for _, tt := range tests {
+		items, err := l.Search(ctx, tt.tags, 20, 1)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.tags, err)
+		}
+		if got := paths(items); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+
+	// Emptying the directory prunes the whole index.
+	for _, name := range []string{"a.jpg", "pets/b.jpg", "c.png"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+	stats, err = l.Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 3 {
+		t.Errorf("removed %d rows, want 3", stats.Removed)
+	}
+	if items, _ := l.Search(ctx, nil, 20, 1); len(items) != 0 {
+		t.Errorf("index still has %q", paths(items))
+	}
+}
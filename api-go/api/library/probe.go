@@ -0,0 +1,260 @@
+package library
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+)
+
+// errNoDuration is returned when a container doesn't record its duration in
+// the headers we read.
+var errNoDuration = errors.New("no duration in container headers")
+
+// probeDuration reads a video's length in seconds from its container
+// headers without decoding any media. Only MP4/QuickTime and
+// Matroska/WebM are understood.
+func probeDuration(file string) (float64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(path.Ext(file)) {
+	case ".mp4", ".m4v", ".mov":
+		return mp4Duration(f)
+	case ".webm", ".mkv":
+		return matroskaDuration(f)
+	}
+	return 0, errNoDuration
+}
+
+// mp4Duration walks the top-level boxes to moov and reads the movie
+// header's timescale and duration. moov is often written after the media
+// data, so boxes are skipped with seeks rather than read.
+func mp4Duration(r io.ReadSeeker) (float64, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	moovStart, moovEnd, err := findBox(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhdStart, _, err := findBox(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var version [4]byte // version and flags
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return 0, err
+	}
+	var timescale uint32
+	var duration uint64
+	if version[0] == 1 {
+		var header struct {
+			Created, Modified uint64
+			Timescale         uint32
+			Duration          uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return 0, err
+		}
+		timescale, duration = header.Timescale, header.Duration
+	} else {
+		var header struct {
+			Created, Modified uint32
+			Timescale         uint32
+			Duration          uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return 0, err
+		}
+		timescale, duration = header.Timescale, uint64(header.Duration)
+	}
+	if timescale == 0 {
+		return 0, errNoDuration
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// findBox returns the payload range of the first box named name between
+// start and end.
+func findBox(r io.ReadSeeker, start, end int64, name string) (int64, int64, error) {
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0: // box runs to the end of its parent
+			size = end - offset
+		case 1: // 64-bit size follows the type
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return 0, 0, errors.New("malformed mp4 box")
+		}
+		if string(header[4:]) == name {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+	return 0, 0, errNoDuration
+}
+
+// Matroska element IDs, including their length marker bits.
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlCluster       = 0x1F43B675
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+)
+
+// matroskaDuration reads Segment > Info > Duration, scaled by the segment's
+// TimecodeScale.
+func matroskaDuration(r io.ReadSeeker) (float64, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	offset := int64(0)
+	for offset < end {
+		id, size, headerSize, err := readElementHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		dataStart := offset + headerSize
+		if size < 0 || dataStart+size > end {
+			size = end - dataStart
+		}
+		switch id {
+		case ebmlSegment:
+			// Step into the segment: its children follow directly.
+			offset = dataStart
+			continue
+		case ebmlInfo:
+			return matroskaInfoDuration(r, size)
+		case ebmlCluster:
+			// Media data started without an Info element.
+			return 0, errNoDuration
+		}
+		offset = dataStart + size
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return 0, errNoDuration
+}
+
+// matroskaInfoDuration reads the Info element's payload of length size.
+func matroskaInfoDuration(r io.ReadSeeker, size int64) (float64, error) {
+	timecodeScale := uint64(1000000) // nanoseconds per tick, the default
+	duration := -1.0
+	for read := int64(0); read < size; {
+		id, elementSize, headerSize, err := readElementHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		if elementSize < 0 || elementSize > 8 {
+			// Neither field we want is this large; skip it.
+			if _, err := r.Seek(max(elementSize, 0), io.SeekCurrent); err != nil {
+				return 0, err
+			}
+			read += headerSize + max(elementSize, 0)
+			continue
+		}
+		data := make([]byte, elementSize)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+		switch id {
+		case ebmlTimecodeScale:
+			timecodeScale = 0
+			for _, b := range data {
+				timecodeScale = timecodeScale<<8 | uint64(b)
+			}
+		case ebmlDuration:
+			switch len(data) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data))
+			}
+		}
+		read += headerSize + elementSize
+	}
+	if duration < 0 {
+		return 0, errNoDuration
+	}
+	return duration * float64(timecodeScale) / 1e9, nil
+}
+
+// readElementHeader reads an EBML element ID and data size. size is -1 for
+// elements of unknown size.
+func readElementHeader(r io.Reader) (id uint64, size int64, headerSize int64, err error) {
+	id, idLen, err := readVint(r, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	rawSize, sizeLen, err := readVint(r, false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size = int64(rawSize)
+	if rawSize == 1<<(7*sizeLen)-1 {
+		size = -1
+	}
+	return id, size, int64(idLen + sizeLen), nil
+}
+
+// readVint reads an EBML variable-length integer. IDs keep their length
+// marker bit; sizes don't.
+func readVint(r io.Reader, keepMarker bool) (uint64, int, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, errors.New("invalid ebml integer")
+	}
+	value := uint64(first[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, nil
+}
@@ -0,0 +1,200 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// box builds an MP4 box with a 32-bit size.
+func box(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, name...), body...)
+}
+
+// largeBox builds an MP4 box with a 64-bit size.
+func largeBox(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = append(out, name...)
+	out = binary.BigEndian.AppendUint64(out, uint64(16+len(body)))
+	return append(out, body...)
+}
+
+// mvhd builds a movie header payload of the given version.
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	out := []byte{version, 0, 0, 0}
+	if version == 1 {
+		out = binary.BigEndian.AppendUint64(out, 0) // created
+		out = binary.BigEndian.AppendUint64(out, 0) // modified
+		out = binary.BigEndian.AppendUint32(out, timescale)
+		return binary.BigEndian.AppendUint64(out, duration)
+	}
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint32(out, timescale)
+	return binary.BigEndian.AppendUint32(out, uint32(duration))
+}
+
+func TestMP4Duration(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00"))
+	mdat := box("mdat", make([]byte, 64))
+	tests := []struct {
+		name    string
+		data    []byte
+		want    float64
+		wantErr error
+	}{
+		{"moov first", bytes.Join([][]byte{ftyp, box("moov", box("mvhd", mvhd(0, 1000, 2500))), mdat}, nil), 2.5, nil},
+		{"moov after mdat", bytes.Join([][]byte{ftyp, mdat, box("moov", box("trak"), box("mvhd", mvhd(0, 600, 3000)))}, nil), 5, nil},
+		{"version 1 header", bytes.Join([][]byte{ftyp, box("moov", box("mvhd", mvhd(1, 90000, 90000*7)))}, nil), 7, nil},
+		{"64-bit box size", bytes.Join([][]byte{ftyp, largeBox("mdat", make([]byte, 8)), box("moov", box("mvhd", mvhd(0, 10, 15)))}, nil), 1.5, nil},
+		{"no moov", bytes.Join([][]byte{ftyp, mdat}, nil), 0, errNoDuration},
+		{"no mvhd", bytes.Join([][]byte{ftyp, box("moov", box("trak"))}, nil), 0, errNoDuration},
+		{"zero timescale", bytes.Join([][]byte{ftyp, box("moov", box("mvhd", mvhd(0, 0, 10)))}, nil), 0, errNoDuration},
+	}
+	for _, tt := range tests {
+		got, err := mp4Duration(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// A box claiming to run past the end of the file.
+	truncated := slices.Concat(ftyp, box("moov", box("mvhd", mvhd(0, 1000, 2500))))
+	binary.BigEndian.PutUint32(truncated[len(ftyp):], 1<<20)
+	if _, err := mp4Duration(bytes.NewReader(truncated)); err == nil {
+		t.Error("truncated moov: got no error")
+	}
+}
+
+// element builds an EBML element. id includes its length marker bits.
+func element(id uint32, payload ...[]byte) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	body := bytes.Join(payload, nil)
+	// An 8-byte size (marker 0x01) fits any payload.
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(body)))
+	size[0] = 0x01
+	return append(append(out, size...), body...)
+}
+
+// unknownSize builds an EBML element whose size is "unknown", as live
+// WebM streams write their Segment.
+func unknownSize(id uint32, payload ...[]byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, id)
+	out = append(out, 0xFF)
+	return append(out, bytes.Join(payload, nil)...)
+}
+
+func float64Bytes(f float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(f))
+}
+
+func float32Bytes(f float32) []byte {
+	return binary.BigEndian.AppendUint32(nil, math.Float32bits(f))
+}
+
+func TestMatroskaDuration(t *testing.T) {
+	header := element(0x1A45DFA3, element(0x4282, []byte("webm")))
+	tests := []struct {
+		name    string
+		data    []byte
+		want    float64
+		wantErr error
+	}{
+		{"default timecode scale", slices.Concat(header, element(ebmlSegment, element(ebmlInfo, element(ebmlDuration, float64Bytes(5000))))), 5, nil},
+		{"float32 duration", slices.Concat(header, element(ebmlSegment, element(ebmlInfo, element(ebmlDuration, float32Bytes(1500))))), 1.5, nil},
+		{"custom timecode scale", slices.Concat(header, element(ebmlSegment, element(ebmlInfo,
+			element(ebmlTimecodeScale, []byte{0x1E, 0x84, 0x80}), // 2,000,000
+			element(ebmlDuration, float64Bytes(2500)),
+		))), 5, nil},
+		{"info after other elements", slices.Concat(header, element(ebmlSegment,
+			element(0x114D9B74, make([]byte, 32)), // SeekHead
+			element(ebmlInfo, element(0x7BA9, []byte("title")), element(ebmlDuration, float64Bytes(3000))),
+		)), 3, nil},
+		{"unknown segment size", slices.Concat(header, unknownSize(ebmlSegment, element(ebmlInfo, element(ebmlDuration, float64Bytes(4000))))), 4, nil},
+		{"cluster before info", slices.Concat(header, element(ebmlSegment, element(ebmlCluster, make([]byte, 8)))), 0, errNoDuration},
+		{"no duration", slices.Concat(header, element(ebmlSegment, element(ebmlInfo, element(ebmlTimecodeScale, []byte{0x0F, 0x42, 0x40})))), 0, errNoDuration},
+		{"no segment", header, 0, errNoDuration},
+	}
+	for _, tt := range tests {
+		got, err := matroskaDuration(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProbeDuration(t *testing.T) {
+	dir := t.TempDir()
+	mp4 := box("moov", box("mvhd", mvhd(0, 1000, 2500)))
+	webm := element(ebmlSegment, element(ebmlInfo, element(ebmlDuration, float64Bytes(2500))))
+	files := map[string][]byte{
+		"a.mp4":  mp4,
+		"b.MOV":  mp4,
+		"c.webm": webm,
+		"d.mkv":  webm,
+		"e.avi":  mp4,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file    string
+		want    float64
+		wantErr error
+	}{
+		{filepath.Join(dir, "a.mp4"), 2.5, nil},
+		{filepath.Join(dir, "b.MOV"), 2.5, nil},
+		{filepath.Join(dir, "c.webm"), 2.5, nil},
+		{filepath.Join(dir, "d.mkv"), 2.5, nil},
+		{filepath.Join(dir, "e.avi"), 0, errNoDuration},
+		{filepath.Join(dir, "missing.mp4"), 0, os.ErrNotExist},
+		{"../../assets/safe-mode/placeholder.mp4", 1, nil},
+	}
+	for _, tt := range tests {
+		got, err := probeDuration(tt.file)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("probeDuration(%s) = %v, %v; want %v, %v", filepath.Base(tt.file), got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadSidecarTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{"none", nil, []string{}},
+		{"json object", map[string]string{"v.mp4.json": `{"tags":["Cat"," outdoor ","cat"]}`}, []string{"cat", "outdoor"}},
+		{"json array", map[string]string{"v.json": `["b", "a"]`}, []string{"a", "b"}},
+		{"text", map[string]string{"v.txt": "Strap On, b\r\n\nc,"}, []string{"b", "c", "strap on"}},
+		{"full name first", map[string]string{"v.mp4.txt": "full", "v.txt": "base"}, []string{"full"}},
+		{"json before text", map[string]string{"v.json": `["json"]`, "v.mp4.txt": "text"}, []string{"json"}},
+		{"malformed json skipped", map[string]string{"v.mp4.json": `{"tags":`, "v.txt": "text"}, []string{"text"}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, content := range tt.files {
+			writeFile(t, filepath.Join(dir, name), content)
+		}
+		if got := readSidecarTags(filepath.Join(dir, "v.mp4")); !slices.Equal(got, tt.want) || got == nil {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"strconv"
+	"strings"
+)
+
+// ProviderName is the registry key for the local media library.
+const ProviderName = "library"
+
+// itemPrefix namespaces library ids in feed_items.video_id.
+const itemPrefix = "library_"
+
+// Provider adapts Library to api.MediaSearcher and api.FolderSource. Files
+// have no creators; folders take their place for subscriptions.
+type Provider struct {
+	library *Library
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.FolderSource  = (*Provider)(nil)
+)
+
+// NewProvider creates a provider searching library.
+func NewProvider(library *Library) *Provider {
+	return &Provider{library: library}
+}
+
+func (p *Provider) Name() string        { return ProviderName }
+func (p *Provider) DisplayName() string { return "Library" }
+
+func (p *Provider) Capabilities() api.Capabilities {
+	return api.Capabilities{
+		TagSearch:  true,
+		TagSuggest: true,
+		SingleItem: true,
+		Folders:    true,
+	}
+}
+
+// ParseTags splits on commas and "|" like Redgifs, since sidecar tags may
+// contain spaces.
+func (p *Provider) ParseTags(query string) []string {
+	return api.SplitTags(query)
+}
+
+func (p *Provider) SearchTerm(tags []string) string {
+	return strings.Join(tags, ", ")
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	page := api.CursorPage(q.Cursor)
+	items, err := p.library.Search(ctx, q.Tags, pageSize(q.Count), page)
+	if err != nil {
+		return api.Page{}, err
+	}
+	return p.itemsPage(items, page), nil
+}
+
+func (p *Provider) FolderItems(ctx context.Context, folder string, count int, cursor string) (api.Page, error) {
+	page := api.CursorPage(cursor)
+	items, err := p.library.FolderItems(ctx, folder, pageSize(count), page)
+	if err != nil {
+		return api.Page{}, err
+	}
+	return p.itemsPage(items, page), nil
+}
+
+// Subfolders lists the folders directly inside folder, for browsing.
+func (p *Provider) Subfolders(ctx context.Context, folder string) ([]string, error) {
+	return p.library.Subfolders(ctx, folder)
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	return p.library.SuggestTags(ctx, query, count)
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	return nil, "", api.ErrUnsupported
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	return nil, api.ErrUnsupported
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	return api.Page{}, api.ErrUnsupported
+}
+
+// GetItem accepts a bare library id or a feed video id ("library_<id>").
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	itemID, err := strconv.ParseInt(strings.TrimPrefix(id, itemPrefix), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("library: %w: invalid id %q", api.ErrNotFound, id)
+	}
+	item, err := p.library.Get(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	file := p.library.toFileToSend(*item)
+	return &file, nil
+}
+
+func (p *Provider) itemsPage(items []Item, page int) api.Page {
+	result := api.Page{}
+	for _, item := range items {
+		result.Files = append(result.Files, p.library.toFileToSend(item))
+	}
+	if len(items) > 0 {
+		result.Next = api.PageCursor(page + 1)
+	}
+	return result
+}
+
+func pageSize(count int) int {
+	if count <= 0 || count > 100 {
+		return 20
+	}
+	return count
+}
@@ -0,0 +1,241 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ScanInterval is how often StartScanner re-indexes the directory.
+const ScanInterval = 10 * time.Minute
+
+var (
+	videoExts = []string{".mp4", ".m4v", ".mov", ".webm", ".mkv"}
+	imageExts = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+)
+
+// ScanStats summarises one scan.
+type ScanStats struct {
+	Indexed int // new or changed files written to the index
+	Skipped int // unchanged files
+	Removed int // index rows whose file is gone
+}
+
+// StartScanner indexes the directory now and then every ScanInterval until
+// ctx is cancelled.
+func (l *Library) StartScanner(ctx context.Context) {
+	ticker := time.NewTicker(ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := l.Scan(ctx)
+		if err != nil {
+			log.Printf("ERROR: Library scan of %s failed: %v", l.dir, err)
+		} else {
+			log.Printf("Library scan of %s: %d indexed, %d unchanged, %d removed",
+				l.dir, stats.Indexed, stats.Skipped, stats.Removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// indexed is what the index holds for a file, to skip unchanged ones.
+type indexed struct {
+	size    int64
+	modTime time.Time
+	tags    []string
+}
+
+// Scan walks the directory, writes new and changed media files to the
+// index and removes files that have gone. Durations are only probed for
+// files whose size or mtime changed; sidecar tags are re-read every time.
+// A file that can't be read or indexed is logged and skipped.
+func (l *Library) Scan(ctx context.Context) (ScanStats, error) {
+	var stats ScanStats
+
+	known, err := l.loadIndex(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	// Empty rather than nil, so an empty directory prunes every row.
+	seen := []string{}
+	err = filepath.WalkDir(l.dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.HasPrefix(d.Name(), ".") && file != l.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(file))
+		isImage := slices.Contains(imageExts, ext)
+		if d.IsDir() || !(isImage || slices.Contains(videoExts, ext)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("WARN: Skipping %s: %v", file, err)
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen = append(seen, rel)
+
+		item := Item{
+			Path:    rel,
+			Folder:  CleanFolder(path.Dir(rel)),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC().Truncate(time.Microsecond),
+			Tags:    readSidecarTags(file),
+			IsImage: isImage,
+		}
+		if prev, ok := known[rel]; ok && prev.size == item.Size && prev.modTime.Equal(item.ModTime) {
+			if slices.Equal(prev.tags, item.Tags) {
+				stats.Skipped++
+				return nil
+			}
+			if err := l.updateTags(ctx, item); err != nil {
+				log.Printf("WARN: Skipping %s: %v", rel, err)
+				return nil
+			}
+			stats.Indexed++
+			return nil
+		}
+		if !isImage {
+			if item.Duration, err = probeDuration(file); err != nil && !errors.Is(err, errNoDuration) {
+				log.Printf("WARN: Could not read duration of %s: %v", rel, err)
+			}
+		}
+		if err := l.upsert(ctx, item); err != nil {
+			log.Printf("WARN: Skipping %s: %v", rel, err)
+			return nil
+		}
+		stats.Indexed++
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to scan %s: %w", l.dir, err)
+	}
+
+	result, err := l.db.Exec(ctx, `DELETE FROM library_items WHERE path <> ALL($1::text[])`, seen)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prune library index: %w", err)
+	}
+	stats.Removed = int(result.RowsAffected())
+	return stats, nil
+}
+
+func (l *Library) loadIndex(ctx context.Context) (map[string]indexed, error) {
+	rows, err := l.db.Query(ctx, `SELECT path, size, mod_time, tags FROM library_items`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load library index: %w", err)
+	}
+	defer rows.Close()
+	known := map[string]indexed{}
+	for rows.Next() {
+		var file string
+		var entry indexed
+		if err := rows.Scan(&file, &entry.size, &entry.modTime, &entry.tags); err != nil {
+			return nil, fmt.Errorf("failed to scan library index: %w", err)
+		}
+		known[file] = entry
+	}
+	return known, rows.Err()
+}
+
+func (l *Library) upsert(ctx context.Context, item Item) error {
+	query := `
+		INSERT INTO library_items (path, folder, size, mod_time, duration, tags, is_image)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (path) DO UPDATE SET
+			folder = EXCLUDED.folder,
+			size = EXCLUDED.size,
+			mod_time = EXCLUDED.mod_time,
+			duration = EXCLUDED.duration,
+			tags = EXCLUDED.tags,
+			is_image = EXCLUDED.is_image,
+			indexed_at = NOW()
+	`
+	_, err := l.db.Exec(ctx, query, item.Path, item.Folder, item.Size, item.ModTime,
+		item.Duration, item.Tags, item.IsImage)
+	if err != nil {
+		return fmt.Errorf("failed to index %s: %w", item.Path, err)
+	}
+	return nil
+}
+
+func (l *Library) updateTags(ctx context.Context, item Item) error {
+	_, err := l.db.Exec(ctx, `UPDATE library_items SET tags = $1, indexed_at = NOW() WHERE path = $2`,
+		item.Tags, item.Path)
+	if err != nil {
+		return fmt.Errorf("failed to update tags of %s: %w", item.Path, err)
+	}
+	return nil
+}
+
+// sidecar is the .json sidecar format. A bare JSON array of tags is also
+// accepted.
+type sidecar struct {
+	Tags []string `json:"tags"`
+}
+
+// readSidecarTags reads tags for file from "<file>.json", "<name>.json",
+// "<file>.txt" or "<name>.txt", whichever exists first. Text sidecars list
+// tags separated by commas or newlines. Tags are lower-cased, de-duplicated
+// and sorted so unchanged sidecars compare equal to the index.
+func readSidecarTags(file string) []string {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	var raw []string
+	for _, candidate := range []string{file + ".json", base + ".json", file + ".txt", base + ".txt"} {
+		data, err := os.ReadFile(candidate)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(candidate, ".json") {
+			var s sidecar
+			if err := json.Unmarshal(data, &s); err != nil {
+				if err := json.Unmarshal(data, &s.Tags); err != nil {
+					log.Printf("WARN: Ignoring malformed sidecar %s: %v", candidate, err)
+					continue
+				}
+			}
+			raw = s.Tags
+		} else {
+			raw = strings.FieldsFunc(string(data), func(r rune) bool {
+				return r == ',' || r == '\n' || r == '\r'
+			})
+		}
+		break
+	}
+
+	tags := []string{}
+	for _, tag := range raw {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
@@ -0,0 +1,30 @@
+package api
+
+import "context"
+
+// RequestLimiter paces the requests to one upstream, see ratelimit.Limiter.
+type RequestLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// SelfLimiting is implemented by providers that can make several upstream
+// requests per call, e.g. retries and re-logins. ratelimit.Wrap hands them
+// its limiter to wait on before each request instead of once per call.
+type SelfLimiting interface {
+	LimitRequests(limiter RequestLimiter)
+}
+
+type backgroundKey struct{}
+
+// WithBackground marks ctx as background work, such as the feed worker's
+// subscription fetches, which upstream rate limiters serve after
+// interactive requests and from a separate budget.
+func WithBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackground reports whether ctx was marked with WithBackground.
+func IsBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is a token bucket refilled continuously at rate tokens per second
+// up to burst. It is not safe for concurrent use; Limiter guards it.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(budget Budget, now time.Time) *bucket {
+	return &bucket{
+		rate:   budget.Rate,
+		burst:  float64(budget.Burst),
+		tokens: float64(budget.Burst),
+		last:   now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// take spends a token if one is available.
+func (b *bucket) take() bool {
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// delay returns how long until a token is available. A bucket with no rate
+// never refills.
+func (b *bucket) delay() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"kannonfoundry/api-go/api"
+	"sync"
+	"time"
+)
+
+// yieldDelay is how often a background request waiting behind interactive
+// ones rechecks the bucket.
+const yieldDelay = 50 * time.Millisecond
+
+// Budget is one class of requests' share of a provider's request rate.
+type Budget struct {
+	Rate  float64 // requests per second
+	Burst int
+	// MaxWait is the longest a request waits for a token before failing
+	// with api.RateLimitError; zero waits until the context is done.
+	MaxWait time.Duration
+}
+
+// Budgets splits a provider's request rate between interactive requests
+// and background ones (see api.WithBackground).
+type Budgets struct {
+	Interactive Budget
+	Background  Budget
+}
+
+// DefaultBudgets lets page loads burst and fail fast rather than hang, and
+// paces the feed worker at a steady rate that leaves room for users.
+var DefaultBudgets = Budgets{
+	Interactive: Budget{Rate: 4, Burst: 8, MaxWait: 3 * time.Second},
+	Background:  Budget{Rate: 1, Burst: 4},
+}
+
+// Limiter is a pair of token buckets shared by every request to one
+// provider. Interactive requests take from their own bucket and, when it
+// is empty, borrow from the background one; background requests only take
+// from theirs, and only while no interactive request is waiting. It is safe
+// for concurrent use.
+type Limiter struct {
+	mu          sync.Mutex
+	budgets     Budgets
+	interactive *bucket
+	background  *bucket
+	waiting     [2]int // by class: interactive, background
+
+	stats [2]ClassStats
+}
+
+const (
+	interactive = iota
+	background
+)
+
+// NewLimiter creates a limiter with full buckets.
+func NewLimiter(budgets Budgets) *Limiter {
+	now := time.Now()
+	return &Limiter{
+		budgets:     budgets,
+		interactive: newBucket(budgets.Interactive, now),
+		background:  newBucket(budgets.Background, now),
+	}
+}
+
+// Wait blocks until the request ctx belongs to may go upstream. It returns
+// an *api.RateLimitError if that would take longer than the class's MaxWait,
+// or ctx's error if ctx is done first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	class, budget := interactive, l.budgets.Interactive
+	if api.IsBackground(ctx) {
+		class, budget = background, l.budgets.Background
+	}
+	start := time.Now()
+	var deadline time.Time
+	if budget.MaxWait > 0 {
+		deadline = start.Add(budget.MaxWait)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats[class].Requests++
+	for {
+		now := time.Now()
+		delay, ok := l.take(class, now)
+		if ok {
+			if waited := now.Sub(start); waited >= time.Millisecond {
+				l.stats[class].Delayed++
+				l.stats[class].WaitedMs += waited.Milliseconds()
+			}
+			return nil
+		}
+		if !deadline.IsZero() && now.Add(delay).After(deadline) {
+			l.stats[class].Rejected++
+			return &api.RateLimitError{RetryAfter: delay}
+		}
+
+		l.waiting[class]++
+		l.mu.Unlock()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+		l.mu.Lock()
+		l.waiting[class]--
+		if ctx.Err() != nil {
+			l.stats[class].Cancelled++
+			return ctx.Err()
+		}
+	}
+}
+
+// take spends a token for class if it may have one now, and otherwise
+// returns how long to wait before trying again. Callers must hold l.mu.
+func (l *Limiter) take(class int, now time.Time) (time.Duration, bool) {
+	l.interactive.refill(now)
+	l.background.refill(now)
+	if class == interactive {
+		if l.interactive.take() {
+			return 0, true
+		}
+		if l.background.take() {
+			l.stats[interactive].Borrowed++
+			return 0, true
+		}
+		return min(l.interactive.delay(), l.background.delay()), false
+	}
+	if l.waiting[interactive] > 0 {
+		return max(l.background.delay(), yieldDelay), false
+	}
+	if l.background.take() {
+		return 0, true
+	}
+	return l.background.delay(), false
+}
+
+// ClassStats counts one class of requests through a Limiter.
+type ClassStats struct {
+	Rate      float64 `json:"rate"`
+	Burst     int     `json:"burst"`
+	Tokens    float64 `json:"tokens"`
+	Waiting   int     `json:"waiting"`
+	Requests  int64   `json:"requests"`
+	Delayed   int64   `json:"delayed"`   // requests that had to wait for a token
+	WaitedMs  int64   `json:"waited_ms"` // total time spent waiting
+	Borrowed  int64   `json:"borrowed"`  // interactive tokens taken from the background budget
+	Rejected  int64   `json:"rejected"`  // requests that would have waited longer than MaxWait
+	Cancelled int64   `json:"cancelled"` // requests whose context ended while waiting
+}
+
+// Stats is a snapshot of a Limiter's buckets and counters.
+type Stats struct {
+	Interactive ClassStats `json:"interactive"`
+	Background  ClassStats `json:"background"`
+}
+
+// Stats returns the limiter's current tokens and counters.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.interactive.refill(now)
+	l.background.refill(now)
+
+	return Stats{
+		Interactive: l.classStats(interactive, l.interactive),
+		Background:  l.classStats(background, l.background),
+	}
+}
+
+// classStats fills in class's bucket state. Callers must hold l.mu.
+func (l *Limiter) classStats(class int, b *bucket) ClassStats {
+	stats := l.stats[class]
+	stats.Rate = b.rate
+	stats.Burst = int(b.burst)
+	stats.Tokens = b.tokens
+	stats.Waiting = l.waiting[class]
+	return stats
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"kannonfoundry/api-go/api"
+	"testing"
+	"time"
+)
+
+// slow is a rate that won't refill a token during a test.
+const slow = 0.001
+
+func TestBurstThenReject(t *testing.T) {
+	l := NewLimiter(Budgets{
+		Interactive: Budget{Rate: slow, Burst: 2, MaxWait: 10 * time.Millisecond},
+		Background:  Budget{Rate: slow},
+	})
+	ctx := context.Background()
+	for i := range 2 {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	err := l.Wait(ctx)
+	var rateLimited *api.RateLimitError
+	if !errors.As(err, &rateLimited) || rateLimited.RetryAfter <= 0 {
+		t.Fatalf("got %v, want a rate limit error with a retry delay", err)
+	}
+	if s := l.Stats().Interactive; s.Requests != 3 || s.Rejected != 1 {
+		t.Errorf("stats %+v, want 3 requests, 1 rejected", s)
+	}
+}
+
+func TestWaitsForRefill(t *testing.T) {
+	l := NewLimiter(Budgets{
+		Interactive: Budget{Rate: 100, Burst: 1, MaxWait: time.Second},
+		Background:  Budget{Rate: slow},
+	})
+	ctx := context.Background()
+	l.Wait(ctx)
+	start := time.Now()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 5*time.Millisecond {
+		t.Errorf("second request waited %s, want about 10ms", waited)
+	}
+	if s := l.Stats().Interactive; s.Delayed != 1 {
+		t.Errorf("stats %+v, want 1 delayed", s)
+	}
+}
+
+func TestInteractiveBorrowsBackground(t *testing.T) {
+	l := NewLimiter(Budgets{
+		Interactive: Budget{Rate: slow, Burst: 1, MaxWait: 10 * time.Millisecond},
+		Background:  Budget{Rate: slow, Burst: 2},
+	})
+	ctx := context.Background()
+	for i := range 3 {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if err := l.Wait(ctx); err == nil {
+		t.Fatal("fourth request went through with both buckets empty")
+	}
+	s := l.Stats()
+	if s.Interactive.Borrowed != 2 || s.Background.Tokens >= 1 {
+		t.Errorf("stats %+v, want 2 borrowed and the background bucket empty", s)
+	}
+
+	// Background requests don't borrow the other way.
+	bg, cancel := context.WithTimeout(api.WithBackground(ctx), 20*time.Millisecond)
+	defer cancel()
+	l = NewLimiter(Budgets{
+		Interactive: Budget{Rate: slow, Burst: 5},
+		Background:  Budget{Rate: slow},
+	})
+	if err := l.Wait(bg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("background request got %v, want to wait until its context ended", err)
+	}
+}
+
+func TestBackgroundYieldsToInteractive(t *testing.T) {
+	l := NewLimiter(Budgets{
+		Interactive: Budget{Rate: slow},
+		Background:  Budget{Rate: slow, Burst: 1},
+	})
+	l.Wait(api.WithBackground(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for l.Stats().Interactive.Waiting == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("interactive request never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A background token turns up while the interactive request sleeps. It
+	// is left for the interactive request rather than taken.
+	l.mu.Lock()
+	l.background.tokens = 1
+	l.mu.Unlock()
+	bg, cancelBg := context.WithTimeout(api.WithBackground(context.Background()), 3*yieldDelay)
+	defer cancelBg()
+	if err := l.Wait(bg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("background request got %v while an interactive one waited", err)
+	}
+
+	// Once nothing interactive is waiting, background requests proceed.
+	cancel()
+	<-done
+	if err := l.Wait(api.WithBackground(context.Background())); err != nil {
+		t.Errorf("background request got %v with nothing else waiting", err)
+	}
+}
+
+func TestCancelWhileWaiting(t *testing.T) {
+	l := NewLimiter(Budgets{
+		Interactive: Budget{Rate: slow},
+		Background:  Budget{Rate: slow},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx) }()
+
+	time.Sleep(10 * time.Millisecond)
+	if s := l.Stats().Interactive; s.Waiting != 1 {
+		t.Errorf("%d requests waiting, want 1", s.Waiting)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait didn't return after its context was cancelled")
+	}
+	if s := l.Stats().Interactive; s.Cancelled != 1 || s.Waiting != 0 {
+		t.Errorf("stats %+v, want 1 cancelled and none waiting", s)
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+)
+
+// Provider waits for its Limiter before every call to another provider, or
+// has the provider wait before each of its upstream requests when it is
+// api.SelfLimiting. Name, display name, capabilities and tag parsing pass
+// straight through.
+type Provider struct {
+	api.MediaSearcher
+	limiter *Limiter
+	// perRequest is set when the provider waits on limiter itself.
+	perRequest bool
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.FolderSource  = (*Provider)(nil)
+	_ api.Wrapper       = (*Provider)(nil)
+	_ api.StatsReporter = (*Provider)(nil)
+)
+
+// Wrap limits calls to provider to budgets.
+func Wrap(provider api.MediaSearcher, budgets Budgets) *Provider {
+	p := &Provider{MediaSearcher: provider, limiter: NewLimiter(budgets)}
+	if self, ok := provider.(api.SelfLimiting); ok {
+		self.LimitRequests(p.limiter)
+		p.perRequest = true
+	}
+	return p
+}
+
+// Unwrap returns the limited provider.
+func (p *Provider) Unwrap() api.MediaSearcher {
+	return p.MediaSearcher
+}
+
+func (p *Provider) wait(ctx context.Context) error {
+	if p.perRequest {
+		return nil
+	}
+	if err := p.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	return nil
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	if err := p.wait(ctx); err != nil {
+		return api.Page{}, err
+	}
+	return p.MediaSearcher.SearchTags(ctx, q)
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.MediaSearcher.SuggestTags(ctx, query, count)
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, "", err
+	}
+	return p.MediaSearcher.SearchCreators(ctx, query, count, cursor)
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.MediaSearcher.GetCreator(ctx, username)
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	if err := p.wait(ctx); err != nil {
+		return api.Page{}, err
+	}
+	return p.MediaSearcher.CreatorItems(ctx, username, count, cursor)
+}
+
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.MediaSearcher.GetItem(ctx, id)
+}
+
+// FolderItems limits folder listings when the wrapped provider has folders.
+func (p *Provider) FolderItems(ctx context.Context, folder string, count int, cursor string) (api.Page, error) {
+	folders, ok := p.MediaSearcher.(api.FolderSource)
+	if !ok {
+		return api.Page{}, fmt.Errorf("%s: %w: folders", p.Name(), api.ErrUnsupported)
+	}
+	if err := p.wait(ctx); err != nil {
+		return api.Page{}, err
+	}
+	return folders.FolderItems(ctx, folder, count, cursor)
+}
+
+// Stats reports the limiter's tokens and counters per class of request.
+func (p *Provider) Stats() map[string]any {
+	return map[string]any{"rate_limit": p.limiter.Stats()}
+}
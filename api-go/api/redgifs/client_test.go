@@ -0,0 +1,116 @@
+package redgifs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRedgifs is a Redgifs API that hands out tokens and answers
+// /v2/gifs/{id} with gif, which sees the token and the attempt number.
+type fakeRedgifs struct {
+	*httptest.Server
+	logins   atomic.Int32
+	requests atomic.Int32
+}
+
+func newFakeRedgifs(t *testing.T, gif func(w http.ResponseWriter, token string, attempt int)) *fakeRedgifs {
+	t.Helper()
+	f := &fakeRedgifs{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/auth/temporary":
+			n := f.logins.Add(1)
+			claims := fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())
+			token := fmt.Sprintf("h.%s.%d", base64.RawURLEncoding.EncodeToString([]byte(claims)), n)
+			fmt.Fprintf(w, `{"token":%q}`, token)
+		case strings.HasPrefix(r.URL.Path, "/v2/gifs/"):
+			n := int(f.requests.Add(1))
+			gif(w, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), n)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+const gifJSON = `{"gif":{"id":"abc","urls":{"sd":"https://media.redgifs.com/Abc-mobile.mp4"}}}`
+
+func testClient(f *fakeRedgifs, opts ...Option) *RedGifsClient {
+	return NewClient(append([]Option{
+		WithBaseURL(f.URL),
+		WithTokenManager(&TokenManager{}),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	}, opts...)...)
+}
+
+// countingLimiter counts waits and runs out after budget of them.
+type countingLimiter struct {
+	waits  atomic.Int32
+	budget int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	if l.waits.Add(1) > l.budget {
+		return fmt.Errorf("test: %w", ErrRateLimited)
+	}
+	return nil
+}
+
+func TestLimiterCountsEveryRequest(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		if attempt < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(gifJSON))
+	})
+	limiter := &countingLimiter{budget: 100}
+	if _, err := testClient(f, WithLimiter(limiter)).GetGif(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+	// One login and three attempts.
+	if got := limiter.waits.Load(); got != 4 {
+		t.Errorf("limiter waited %d times, want 4", got)
+	}
+}
+
+func TestLimiterStopsRetries(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	limiter := &countingLimiter{budget: 2}
+	_, err := testClient(f, WithLimiter(limiter)).GetGif(context.Background(), "abc")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v, want rate limited", err)
+	}
+	if got := f.requests.Load(); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestHTTPClientOptions(t *testing.T) {
+	if c := NewClient(WithHTTPClient(nil)); c.httpClient != defaultHTTPClient {
+		t.Error("WithHTTPClient(nil) replaced the shared client")
+	}
+	if c := NewClient(WithHTTPClient(nil), WithTimeout(time.Second)); c.httpClient.Timeout != time.Second {
+		t.Errorf("timeout is %s, want 1s", c.httpClient.Timeout)
+	}
+
+	custom := &http.Client{}
+	c := NewClient(WithTimeout(time.Second), WithHTTPClient(custom))
+	if c.httpClient.Timeout != time.Second {
+		t.Errorf("WithTimeout before WithHTTPClient: timeout is %s, want 1s", c.httpClient.Timeout)
+	}
+	if custom.Timeout != 0 || defaultHTTPClient.Timeout != DefaultTimeout {
+		t.Error("WithTimeout modified a caller's or the shared client")
+	}
+}
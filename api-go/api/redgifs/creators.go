@@ -0,0 +1,42 @@
+package redgifs
+
+import (
+	"context"
+	"encoding/json"
+	"kannonfoundry/api-go/api"
+	"net/url"
+	"strconv"
+)
+
+type creatorsResponse struct {
+	Items []CreatorResponse `json:"items"`
+}
+
+// SearchCreators finds creators whose name matches query.
+func (c *RedGifsClient) SearchCreators(ctx context.Context, query string, count int, page int) ([]CreatorResponse, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	q.Set("page", strconv.Itoa(page))
+	q.Set("count", strconv.Itoa(count))
+	resp, err := c.get(ctx, c.v1Url()+"/creators/search?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var searchResp creatorsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
+		return nil, err
+	}
+	return searchResp.Items, nil
+}
+
+// FormatCreatorUrls rewrites creator avatars to go through the proxy.
+func FormatCreatorUrls(creators []api.Creator, safe bool) {
+	for i, creator := range creators {
+		creators[i].ProfileImageURL = ProxyURL(creator.ProfileImageURL, safe)
+	}
+}
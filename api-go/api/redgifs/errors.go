@@ -0,0 +1,42 @@
+package redgifs
+
+import (
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"net/http"
+)
+
+// The client's errors are the provider-agnostic ones from package api, so
+// callers can match them with errors.Is/As without knowing the source.
+var (
+	ErrNotFound     = api.ErrNotFound
+	ErrUnauthorized = api.ErrUnauthorized
+	ErrRateLimited  = api.ErrRateLimited
+	ErrUpstream     = api.ErrUpstream
+)
+
+// RateLimitError is returned for a 429 that outlasted our retries.
+type RateLimitError = api.RateLimitError
+
+// checkResponse maps a non-200 response to one of the package's errors.
+func checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("redgifs: %w: %s", ErrNotFound, resp.Request.URL.Path)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("redgifs: %w: %s", ErrUnauthorized, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"))
+		return &RateLimitError{RetryAfter: retryAfter}
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("redgifs: %w: %s", ErrUpstream, resp.Status)
+	}
+	return fmt.Errorf("redgifs request failed: %s", resp.Status)
+}
+
+// HTTPStatus returns the status a handler should answer with for err.
+func HTTPStatus(err error) int {
+	return api.HTTPStatus(err)
+}
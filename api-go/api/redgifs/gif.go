@@ -0,0 +1,44 @@
+package redgifs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"net/url"
+	"strings"
+)
+
+type gifLookupResponse struct {
+	Gif GifResponse `json:"gif"`
+}
+
+// VideoID returns the feed/video identifier used across the app for a
+// Redgifs gif id, e.g. "redgif_abc".
+func VideoID(id string) string {
+	return "redgif_" + id
+}
+
+// GetGif looks up a single gif. id may be a bare Redgifs id or a video id as
+// stored in feed_items ("redgif_<id>").
+func (c *RedGifsClient) GetGif(ctx context.Context, id string) (*api.FileToSend, error) {
+	id = strings.ToLower(strings.TrimPrefix(id, "redgif_"))
+	resp, err := c.get(ctx, c.v2Url()+"/gifs/"+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var lookup gifLookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lookup); err != nil {
+		return nil, err
+	}
+	file := toFileToSend(lookup.Gif)
+	if file == nil {
+		return nil, fmt.Errorf("%w: gif %s has no playable url", ErrNotFound, id)
+	}
+	return file, nil
+}
@@ -0,0 +1,87 @@
+package redgifs
+
+import (
+	"kannonfoundry/api-go/api"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL   = "https://api.redgifs.com"
+	DefaultUserAgent = "kannonfoundry-api-go/1.0"
+	DefaultTimeout   = 30 * time.Second
+)
+
+// defaultHTTPClient is shared by every client that doesn't supply its own,
+// so connections to Redgifs are pooled across requests.
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// Option configures a RedGifsClient.
+type Option func(*RedGifsClient)
+
+// WithBaseURL points the client at a different API host, e.g. a local fake
+// Redgifs server in tests or staging.
+func WithBaseURL(baseURL string) Option {
+	return func(c *RedGifsClient) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithHTTPClient replaces the shared HTTP client. A nil client keeps the
+// shared one.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *RedGifsClient) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent on every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *RedGifsClient) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets the overall per-request timeout. It applies to whichever
+// HTTP client the client ends up with, in any option order; that client is
+// copied so the shared default client is never modified.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *RedGifsClient) {
+		c.timeout = &timeout
+	}
+}
+
+// WithTokenManager makes the client use tokens instead of the shared manager
+// for its base URL.
+func WithTokenManager(tokens *TokenManager) Option {
+	return func(c *RedGifsClient) {
+		c.tokens = tokens
+	}
+}
+
+// WithLimiter makes the client wait on limiter before every request it
+// sends, including retries and logins.
+func WithLimiter(limiter api.RequestLimiter) Option {
+	return func(c *RedGifsClient) {
+		c.limiter = limiter
+	}
+}
+
+// WithRetries sets how many times a failed request is retried. Zero disables
+// retries.
+func WithRetries(maxRetries int) Option {
+	return func(c *RedGifsClient) {
+		c.retry.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff sets the initial and maximum delay between retries.
+func WithBackoff(base, max time.Duration) Option {
+	return func(c *RedGifsClient) {
+		c.retry.baseDelay = base
+		c.retry.maxDelay = max
+	}
+}
@@ -0,0 +1,144 @@
+package redgifs
+
+import (
+	"context"
+	"kannonfoundry/api-go/api"
+	"strings"
+)
+
+// ProviderName is the registry key for Redgifs.
+const ProviderName = "redgifs"
+
+// Provider adapts RedGifsClient to api.MediaSearcher.
+type Provider struct {
+	client *RedGifsClient
+}
+
+var (
+	_ api.MediaSearcher = (*Provider)(nil)
+	_ api.SelfLimiting  = (*Provider)(nil)
+)
+
+// NewProvider creates a Redgifs provider; opts configure its client.
+func NewProvider(opts ...Option) *Provider {
+	return &Provider{client: NewClient(opts...)}
+}
+
+// Client returns the underlying client for Redgifs-specific calls.
+func (p *Provider) Client() *RedGifsClient {
+	return p.client
+}
+
+// LimitRequests makes the client wait on limiter before each request, so
+// its retries and re-logins are rate limited too.
+func (p *Provider) LimitRequests(limiter api.RequestLimiter) {
+	p.client.limiter = limiter
+}
+
+func (p *Provider) Name() string        { return ProviderName }
+func (p *Provider) DisplayName() string { return "Redgifs" }
+
+func (p *Provider) Capabilities() api.Capabilities {
+	return api.Capabilities{
+		TagSearch:      true,
+		TagSuggest:     true,
+		CreatorSearch:  true,
+		CreatorProfile: true,
+		CreatorItems:   true,
+		SingleItem:     true,
+		Orders:         Orders,
+		MediaTypes:     MediaTypes,
+		VerifiedOnly:   true,
+		MinDuration:    true,
+	}
+}
+
+func (p *Provider) ParseTags(query string) []string {
+	return ParseTags(query)
+}
+
+func (p *Provider) SearchTerm(tags []string) string {
+	return strings.Join(tags, "|")
+}
+
+func (p *Provider) SearchTags(ctx context.Context, q api.Query) (api.Page, error) {
+	page := api.CursorPage(q.Cursor)
+	files, err := p.client.SearchWithOptions(ctx, SearchOptions{
+		Tags:         q.Tags,
+		Order:        q.Order,
+		MediaType:    q.MediaType,
+		VerifiedOnly: q.VerifiedOnly,
+		MinDuration:  q.MinDuration,
+		Count:        q.Count,
+		Page:         page,
+	})
+	return filesPage(files, page), err
+}
+
+func (p *Provider) SuggestTags(ctx context.Context, query string, count int) ([]api.Tag, error) {
+	suggestions, err := p.client.SuggestTags(ctx, query, count)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]api.Tag, 0, len(suggestions))
+	for _, s := range suggestions {
+		tags = append(tags, api.Tag{Name: s.Text, Count: s.Count})
+	}
+	return tags, nil
+}
+
+func (p *Provider) SearchCreators(ctx context.Context, query string, count int, cursor string) ([]api.Creator, string, error) {
+	page := api.CursorPage(cursor)
+	found, err := p.client.SearchCreators(ctx, query, count, page)
+	if err != nil {
+		return nil, "", err
+	}
+	creators := make([]api.Creator, 0, len(found))
+	for _, creator := range found {
+		creators = append(creators, toCreator(creator))
+	}
+	next := ""
+	if len(found) > 0 {
+		next = api.PageCursor(page + 1)
+	}
+	return creators, next, nil
+}
+
+func (p *Provider) GetCreator(ctx context.Context, username string) (*api.Creator, error) {
+	creator, err := p.client.GetCreator(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	c := toCreator(*creator)
+	return &c, nil
+}
+
+func (p *Provider) CreatorItems(ctx context.Context, username string, count int, cursor string) (api.Page, error) {
+	page := api.CursorPage(cursor)
+	files, err := p.client.SearchByUser(ctx, username, count, page)
+	return filesPage(files, page), err
+}
+
+func (p *Provider) GetItem(ctx context.Context, id string) (*api.FileToSend, error) {
+	return p.client.GetGif(ctx, id)
+}
+
+// filesPage wraps a numbered page of results; an empty page ends paging.
+func filesPage(files []api.FileToSend, page int) api.Page {
+	result := api.Page{Files: files}
+	if len(files) > 0 {
+		result.Next = api.PageCursor(page + 1)
+	}
+	return result
+}
+
+func toCreator(creator CreatorResponse) api.Creator {
+	return api.Creator{
+		Username:        creator.Username,
+		Description:     creator.Description,
+		ProfileImageURL: creator.ProfileImageUrl,
+		Followers:       creator.Followers,
+		Items:           creator.Gifs,
+		Verified:        creator.Verified,
+	}
+}
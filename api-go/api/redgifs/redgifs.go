@@ -1,82 +1,221 @@
 package redgifs
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/auth"
+	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 type RedGifsClient struct {
-	authToken   string
-	tokenExpiry int64
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	tokens     *TokenManager
+	retry      retryPolicy
+	limiter    api.RequestLimiter
+	timeout    *time.Duration // set by WithTimeout, applied in NewClient
 }
 type loginResponse struct {
 	Token string `json:"token"`
 }
 
-func NewClient() *RedGifsClient {
-	return &RedGifsClient{}
+// NewClient creates a Redgifs client. Without options it talks to the public
+// API using a shared, connection-pooling HTTP client. Clients for the same
+// base URL share one TokenManager, so creating a client per request is cheap.
+func NewClient(opts ...Option) *RedGifsClient {
+	c := &RedGifsClient{
+		baseURL:    DefaultBaseURL,
+		httpClient: defaultHTTPClient,
+		userAgent:  DefaultUserAgent,
+		retry:      defaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout != nil {
+		httpClient := *c.httpClient
+		httpClient.Timeout = *c.timeout
+		c.httpClient = &httpClient
+	}
+	if c.tokens == nil {
+		c.tokens = SharedTokenManager(c.baseURL)
+	}
+	return c
 }
 
-var (
-	baseUrl = "https://api.redgifs.com"
-	v1Url   = baseUrl + "/v1"
-	v2Url   = baseUrl + "/v2"
-)
+func (c *RedGifsClient) v1Url() string {
+	return c.baseURL + "/v1"
+}
+
+func (c *RedGifsClient) v2Url() string {
+	return c.baseURL + "/v2"
+}
+
+// newRequest builds a GET request carrying the client's User-Agent and, when
+// present, the bearer token.
+func (c *RedGifsClient) newRequest(ctx context.Context, url string, token string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// get performs an authenticated GET, retrying network errors, 429s and 5xx
+// responses with exponential backoff. A 429 Retry-After header overrides the
+// computed delay. Waiting stops as soon as ctx is cancelled.
+func (c *RedGifsClient) get(ctx context.Context, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.getAuthorized(ctx, url)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Out of budget: retrying would only wait for the limiter again.
+		if errors.Is(err, api.ErrRateLimited) {
+			return nil, err
+		}
+		if attempt >= c.retry.maxRetries {
+			return resp, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if err == nil {
+			if !retryable(resp.StatusCode) {
+				return resp, nil
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+					if retryAfter > maxRetryAfter {
+						return resp, nil
+					}
+					delay = retryAfter
+				}
+			}
+			resp.Body.Close()
+			log.Printf("Redgifs request %s returned %s, retrying in %s", url, resp.Status, delay)
+		} else {
+			log.Printf("Redgifs request %s failed: %v, retrying in %s", url, err, delay)
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// getAuthorized performs a single authenticated GET. If the API rejects the
+// cached token with 401 the token is dropped and the request is repeated once
+// with a fresh login.
+func (c *RedGifsClient) getAuthorized(ctx context.Context, url string) (*http.Response, error) {
+	resp, token, err := c.getWithToken(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+	c.tokens.Invalidate(token)
+	resp, _, err = c.getWithToken(ctx, url)
+	return resp, err
+}
+
+func (c *RedGifsClient) getWithToken(ctx context.Context, url string) (*http.Response, string, error) {
+	token, err := c.tokens.Token(ctx, c.login)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to login: %w", err)
+	}
+	req, err := c.newRequest(ctx, url, token)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp, token, nil
+}
 
-func (client *RedGifsClient) login() error {
-	client.authToken = "" // reset any existing token
-	resp, err := http.Get(v2Url + "/auth/temporary")
+// do sends req once the limiter, if any, lets it go, so every attempt,
+// retry and login counts against the rate limit.
+func (c *RedGifsClient) do(req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, fmt.Errorf("redgifs: %w", err)
+		}
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("redgifs: %w: %w", ErrUpstream, err)
+	}
+	return resp, nil
+}
+
+// login fetches a temporary token and returns it with its expiry.
+func (c *RedGifsClient) login(ctx context.Context) (string, int64, error) {
+	req, err := c.newRequest(ctx, c.v2Url()+"/auth/temporary", "")
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to login: %s", resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return "", 0, err
 	}
 
 	var loginResp loginResponse
 	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-		return err
+		return "", 0, err
 	}
 
-	client.authToken = loginResp.Token
-
 	// Decode JWT token to extract exp
 	parts := strings.Split(loginResp.Token, ".")
 	if len(parts) != 3 {
-		return fmt.Errorf("invalid JWT token format")
+		return "", 0, fmt.Errorf("invalid JWT token format")
 	}
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return fmt.Errorf("failed to decode JWT payload: %w", err)
+		return "", 0, fmt.Errorf("failed to decode JWT payload: %w", err)
 	}
 	var claims struct {
 		Exp int64 `json:"exp"`
 	}
 	if err := json.Unmarshal(payload, &claims); err != nil {
-		return fmt.Errorf("failed to parse JWT claims: %w", err)
+		return "", 0, fmt.Errorf("failed to parse JWT claims: %w", err)
 	}
-	client.tokenExpiry = claims.Exp
 
-	return nil
+	return loginResp.Token, claims.Exp, nil
 }
 
 func (c *RedGifsClient) IsTokenExpired() bool {
-	if c.tokenExpiry == 0 {
-		return true // treat unset expiry as expired
-	}
-	return time.Now().Unix() >= c.tokenExpiry
+	return c.tokens.Expired()
 }
 
 type UrlResponse struct {
-	Hd string `json:"hd"`
-	Sd string `json:"sd"`
+	Hd         string `json:"hd"`
+	Sd         string `json:"sd"`
+	Poster     string `json:"poster"`
+	Thumbnail  string `json:"thumbnail"`
+	VThumbnail string `json:"vthumbnail"`
 }
 type GifResponse struct {
 	Urls      UrlResponse  `json:"urls"`
@@ -84,6 +223,15 @@ type GifResponse struct {
 	CTA       *CtaResponse `json:"cta"`
 	Username  string       `json:"userName"`
 	CreatedAt int64        `json:"createDate"`
+	Tags      []string     `json:"tags"`
+	Duration  float64      `json:"duration"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	Views     int64        `json:"views"`
+	Likes     int64        `json:"likes"`
+	HasAudio  bool         `json:"hasAudio"`
+	Verified  bool         `json:"verified"`
+	Type      int          `json:"type"` // 1 video, 2 image
 }
 type CtaResponse struct {
 	ShowReason string `json:"showReason"`
@@ -96,67 +244,25 @@ func (c *RedGifsClient) FormatAndModifySearch(tags []string, authorID int64) (se
 	return strings.Join(tags, "|"), nil
 }
 
-func (c *RedGifsClient) Search(tags []string, count int, page int) (files []api.FileToSend, err error) {
-	if c.IsTokenExpired() {
-		if err := c.login(); err != nil {
-			return nil, fmt.Errorf("failed to login: %w", err)
-		}
-	}
-	req, err := http.NewRequest("GET", v2Url+"/gifs/search?type=g&order=latest&page="+fmt.Sprint(page)+"&count="+fmt.Sprint(count)+"&tags="+strings.Join(tags, "|"), nil)
-	if err != nil {
-		return nil, err
-	}
-	fmt.Printf("Searching: %s\n", req.URL.String())
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search request failed: %s", resp.Status)
-	}
-	var searchResp GifsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
-		return nil, err
-	}
-	var results []api.FileToSend
-	for _, gif := range searchResp.Gifs {
-		if gif.CTA != nil {
-			continue //skip adverts
-		}
-		toFileToSend := toFileToSend(gif)
-		if toFileToSend != nil {
-			results = append(results, *toFileToSend)
-		}
-	}
-	return results, nil
+// Search returns the latest gifs matching all of tags. Used by tag
+// subscriptions; see SearchWithOptions for ordering and filters.
+func (c *RedGifsClient) Search(ctx context.Context, tags []string, count int, page int) (files []api.FileToSend, err error) {
+	return c.SearchWithOptions(ctx, SearchOptions{
+		Tags:  tags,
+		Count: count,
+		Page:  page,
+	})
 }
 
-func (c *RedGifsClient) SearchByUser(username string, count int, page int) (files []api.FileToSend, err error) {
-	if c.IsTokenExpired() {
-		if err := c.login(); err != nil {
-			return nil, fmt.Errorf("failed to login: %w", err)
-		}
-	}
-	req, err := http.NewRequest("GET", v2Url+"/users/"+username+"/search?type=g&order=new&page="+fmt.Sprint(page)+"&count="+fmt.Sprint(count), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *RedGifsClient) SearchByUser(ctx context.Context, username string, count int, page int) (files []api.FileToSend, err error) {
+	resp, err := c.get(ctx, c.v2Url()+"/users/"+username+"/search?type=g&order=new&page="+fmt.Sprint(page)+"&count="+fmt.Sprint(count))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search request failed: %s", resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return nil, err
 	}
 	var searchResp GifsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
@@ -175,15 +281,23 @@ func (c *RedGifsClient) SearchByUser(username string, count int, page int) (file
 	return results, nil
 }
 
-func FormatFileUrls(files []api.FileToSend) {
+// FormatFileUrls rewrites every media URL on files to go through the proxy.
+// In safe mode the proxy serves placeholders for them.
+func FormatFileUrls(files []api.FileToSend, safe bool) {
 	for i, file := range files {
-		files[i].URL = ProxyURL(file.URL)
+		files[i].URL = ProxyURL(file.URL, safe)
+		files[i].HDURL = ProxyURL(file.HDURL, safe)
+		files[i].SDURL = ProxyURL(file.SDURL, safe)
+		files[i].PosterURL = ProxyURL(file.PosterURL, safe)
+		files[i].ThumbnailURL = ProxyURL(file.ThumbnailURL, safe)
 	}
 }
 
 // ProxyURL rewrites known Redgifs hosts to local /rgp/ proxy
-// Uses query parameter ?h={host} to specify which Redgifs subdomain to use
-func ProxyURL(u string) string {
+// Uses query parameter ?h={host} to specify which Redgifs subdomain to use,
+// and signs the URL (see auth.SignProxyURL) so the proxy only fetches files
+// we linked to. Safe mode URLs get a placeholder instead of the file.
+func ProxyURL(u string, safe bool) string {
 	if u == "" {
 		return u
 	}
@@ -219,11 +333,14 @@ func ProxyURL(u string) string {
 		return u // not a redgifs URL
 	}
 
-	// Return /rgp/{path}?h={host}
-	if pathPortion == "" {
-		return "/rgp/?h=" + host
+	// Return /rgp/{path}?h={host}&e={expires}&s={signature}[&sfw=1]. The proxy
+	// never forwarded the original query string, so it's dropped.
+	pathPortion, _, _ = strings.Cut(pathPortion, "?")
+	path, err := url.PathUnescape(pathPortion)
+	if err != nil {
+		path = pathPortion
 	}
-	return "/rgp/" + pathPortion + "?h=" + host
+	return "/rgp/" + pathPortion + "?" + auth.SignProxyURL(host, path, safe)
 }
 
 func toFileToSend(gif GifResponse) *api.FileToSend {
@@ -234,11 +351,29 @@ func toFileToSend(gif GifResponse) *api.FileToSend {
 	if url == "" {
 		return nil
 	}
+	thumbnail := gif.Urls.Thumbnail
+	if thumbnail == "" {
+		thumbnail = gif.Urls.VThumbnail
+	}
 	return &api.FileToSend{
-		Name:      "redgif_" + gif.Id,
-		URL:       url,
-		Username:  gif.Username,
-		CreatedAt: gif.CreatedAt,
+		Name:         VideoID(gif.Id),
+		Provider:     ProviderName,
+		URL:          url,
+		Username:     gif.Username,
+		CreatedAt:    gif.CreatedAt,
+		HDURL:        gif.Urls.Hd,
+		SDURL:        gif.Urls.Sd,
+		PosterURL:    gif.Urls.Poster,
+		ThumbnailURL: thumbnail,
+		Tags:         gif.Tags,
+		Duration:     gif.Duration,
+		Width:        gif.Width,
+		Height:       gif.Height,
+		Views:        gif.Views,
+		Likes:        gif.Likes,
+		HasAudio:     gif.HasAudio,
+		Verified:     gif.Verified,
+		IsImage:      gif.Type == 2,
 	}
 }
 
@@ -246,29 +381,20 @@ type CreatorResponse struct {
 	Username        string `json:"userName"`
 	Description     string `json:"description"`
 	ProfileImageUrl string `json:"profileImageUrl"`
+	Followers       int64  `json:"followers"`
+	Gifs            int64  `json:"gifs"`
+	Verified        bool   `json:"verified"`
 }
 
-func (c *RedGifsClient) GetCreator(username string) (creator *CreatorResponse, err error) {
-	if c.IsTokenExpired() {
-		if err := c.login(); err != nil {
-			return nil, fmt.Errorf("failed to login: %w", err)
-		}
-	}
-	req, err := http.NewRequest("GET", v1Url+"/users/"+username, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *RedGifsClient) GetCreator(ctx context.Context, username string) (creator *CreatorResponse, err error) {
+	resp, err := c.get(ctx, c.v1Url()+"/users/"+username)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search request failed: %s", resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return nil, err
 	}
 	var searchResp CreatorResponse
 	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
@@ -0,0 +1,94 @@
+package redgifs
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryBase  = 500 * time.Millisecond
+	DefaultRetryMax   = 10 * time.Second
+)
+
+// maxRetryAfter caps how long we'll wait on a 429 Retry-After before giving
+// up and returning the error to the caller instead.
+const maxRetryAfter = time.Minute
+
+// retryPolicy controls how failed upstream requests are retried.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxRetries: DefaultMaxRetries,
+	baseDelay:  DefaultRetryBase,
+	maxDelay:   DefaultRetryMax,
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt (0-based): exponential
+// growth from baseDelay capped at maxDelay, with the upper half jittered so
+// concurrent callers don't retry in lockstep.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseDelay << attempt
+	if d <= 0 || d > p.maxDelay {
+		d = p.maxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
+
+// parseRetryAfter reads a Retry-After header given either as seconds or as an
+// HTTP date. It returns false when the header is absent or unparseable.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
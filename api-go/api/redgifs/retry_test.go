@@ -0,0 +1,128 @@
+package redgifs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetriesServerErrors(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		if attempt < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(gifJSON))
+	})
+	file, err := testClient(f).GetGif(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != VideoID("abc") {
+		t.Errorf("got %q, want %q", file.Name, VideoID("abc"))
+	}
+	if got := f.requests.Load(); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err := testClient(f, WithRetries(2)).GetGif(context.Background(), "abc")
+	if !errors.Is(err, ErrUpstream) {
+		t.Fatalf("got %v, want upstream error", err)
+	}
+	if got := f.requests.Load(); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(gifJSON))
+	})
+	if _, err := testClient(f).GetGif(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.requests.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	_, err := testClient(f).GetGif(context.Background(), "abc")
+	var rateLimited *RateLimitError
+	if !errors.As(err, &rateLimited) || rateLimited.RetryAfter != time.Hour {
+		t.Fatalf("got %v, want rate limited for an hour", err)
+	}
+	if got := f.requests.Load(); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"soon", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-5", 0, true},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Dates are relative to now, to the second.
+	got, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("a minute from now: got %s, %v", got, ok)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{maxRetries: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		// Shifting this far overflows; still capped.
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		// Jitter keeps every delay in the upper half.
+		for range 20 {
+			if d := p.backoff(tt.attempt); d < tt.full/2 || d >= tt.full {
+				t.Errorf("backoff(%d) = %s, want [%s, %s)", tt.attempt, d, tt.full/2, tt.full)
+				break
+			}
+		}
+	}
+	if d := (retryPolicy{baseDelay: 1, maxDelay: 1}).backoff(0); d != 1 {
+		t.Errorf("a delay too short to jitter became %s", d)
+	}
+}
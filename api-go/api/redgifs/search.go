@@ -0,0 +1,144 @@
+package redgifs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Sort orders accepted by the gif search endpoint.
+const (
+	OrderLatest   = "latest"
+	OrderTrending = "trending"
+	OrderTop      = "top"
+	OrderTopWeek  = "top7"
+	OrderTopMonth = "top28"
+)
+
+// Media types accepted by the gif search endpoint.
+const (
+	MediaTypeVideo = "g"
+	MediaTypeImage = "i"
+)
+
+// Orders lists the supported sort orders with a display label, in the order
+// they should be offered to users.
+var Orders = []api.Order{
+	{Value: OrderLatest, Label: "Latest"},
+	{Value: OrderTrending, Label: "Trending"},
+	{Value: OrderTop, Label: "Top"},
+	{Value: OrderTopWeek, Label: "Top this week"},
+	{Value: OrderTopMonth, Label: "Top this month"},
+}
+
+// MediaTypes lists the supported media types with a display label.
+var MediaTypes = []api.Order{
+	{Value: MediaTypeVideo, Label: "Videos"},
+	{Value: MediaTypeImage, Label: "Images"},
+}
+
+// SearchOptions controls a gif search. Zero values fall back to the latest
+// videos, 20 per page, first page.
+type SearchOptions struct {
+	Tags         []string
+	Order        string
+	MediaType    string
+	VerifiedOnly bool
+	MinDuration  float64 // seconds; filtered locally, the API has no such parameter
+	Count        int
+	Page         int
+}
+
+// ValidOrder reports whether order is one of the supported sort orders.
+func ValidOrder(order string) bool {
+	for _, o := range Orders {
+		if o.Value == order {
+			return true
+		}
+	}
+	return false
+}
+
+func (o SearchOptions) query() url.Values {
+	order := o.Order
+	if !ValidOrder(order) {
+		order = OrderLatest
+	}
+	mediaType := o.MediaType
+	if mediaType != MediaTypeImage {
+		mediaType = MediaTypeVideo
+	}
+	count := o.Count
+	if count <= 0 {
+		count = 20
+	}
+	page := o.Page
+	if page < 1 {
+		page = 1
+	}
+
+	q := url.Values{}
+	q.Set("type", mediaType)
+	q.Set("order", order)
+	q.Set("page", strconv.Itoa(page))
+	q.Set("count", strconv.Itoa(count))
+	q.Set("tags", strings.Join(o.Tags, "|"))
+	if o.VerifiedOnly {
+		q.Set("verified", "y")
+	}
+	return q
+}
+
+// keep applies the filters the API can't do for us.
+func (o SearchOptions) keep(gif GifResponse) bool {
+	if o.VerifiedOnly && !gif.Verified {
+		return false
+	}
+	if o.MinDuration > 0 && gif.Duration < o.MinDuration {
+		return false
+	}
+	return true
+}
+
+// SearchWithOptions searches gifs by tag with the given ordering and filters.
+func (c *RedGifsClient) SearchWithOptions(ctx context.Context, opts SearchOptions) (files []api.FileToSend, err error) {
+	url := c.v2Url() + "/gifs/search?" + opts.query().Encode()
+	fmt.Printf("Searching: %s\n", url)
+
+	resp, err := c.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var searchResp GifsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
+		return nil, err
+	}
+	var results []api.FileToSend
+	for _, gif := range searchResp.Gifs {
+		if gif.CTA != nil {
+			continue //skip adverts
+		}
+		if !opts.keep(gif) {
+			continue
+		}
+		toFileToSend := toFileToSend(gif)
+		if toFileToSend != nil {
+			results = append(results, *toFileToSend)
+		}
+	}
+	return results, nil
+}
+
+// ParseTags splits a free-text search into tags with api.SplitTags.
+func ParseTags(query string) []string {
+	return api.SplitTags(query)
+}
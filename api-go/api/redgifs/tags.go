@@ -0,0 +1,39 @@
+package redgifs
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// TagSuggestion is a canonical tag name with the number of gifs carrying it.
+type TagSuggestion struct {
+	Text  string `json:"text"`
+	Count int64  `json:"count"`
+}
+
+// SuggestTags returns canonical tags matching the start of query, most used
+// first.
+func (c *RedGifsClient) SuggestTags(ctx context.Context, query string, count int) ([]TagSuggestion, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	q.Set("count", strconv.Itoa(count))
+	resp, err := c.get(ctx, c.v2Url()+"/tags/suggest?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var suggestions []TagSuggestion
+	if err := json.NewDecoder(resp.Body).Decode(&suggestions); err != nil {
+		return nil, err
+	}
+	if len(suggestions) > count {
+		suggestions = suggestions[:count]
+	}
+	return suggestions, nil
+}
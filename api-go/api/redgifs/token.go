@@ -0,0 +1,128 @@
+package redgifs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before expiry a cached token is replaced.
+const tokenRefreshMargin = 5 * time.Minute
+
+// TokenManager caches the temporary Redgifs JWT and shares it between every
+// client talking to the same API host. It is safe for concurrent use; when
+// several callers need a new token at once only one login is performed and the
+// others wait for its result.
+type TokenManager struct {
+	mu         sync.Mutex
+	token      string
+	expiry     int64
+	refreshing chan struct{} // closed when the in-flight refresh finishes
+	refreshErr error
+}
+
+// loginFunc performs a login and returns the token and its unix expiry.
+type loginFunc func(ctx context.Context) (token string, expiry int64, err error)
+
+var (
+	tokenManagersMu sync.Mutex
+	tokenManagers   = map[string]*TokenManager{}
+)
+
+// SharedTokenManager returns the process-wide token manager for baseURL.
+func SharedTokenManager(baseURL string) *TokenManager {
+	tokenManagersMu.Lock()
+	defer tokenManagersMu.Unlock()
+	m, ok := tokenManagers[baseURL]
+	if !ok {
+		m = &TokenManager{}
+		tokenManagers[baseURL] = m
+	}
+	return m
+}
+
+// Token returns a cached token, logging in first when there is none or it is
+// about to expire. Waiting for another caller's login stops when ctx is done.
+func (m *TokenManager) Token(ctx context.Context, login loginFunc) (string, error) {
+	for {
+		m.mu.Lock()
+		if m.fresh() {
+			token := m.token
+			m.mu.Unlock()
+			return token, nil
+		}
+		if m.refreshing == nil {
+			break // we do the login, still holding m.mu
+		}
+		// Another caller is already logging in; wait for it.
+		done := m.refreshing
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-done:
+		}
+		m.mu.Lock()
+		err := m.refreshErr
+		token := m.token
+		m.mu.Unlock()
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			return "", err
+		}
+		// The other caller gave up; try again with our own context.
+	}
+
+	done := make(chan struct{})
+	m.refreshing = done
+	m.mu.Unlock()
+
+	token, expiry, err := login(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.token = token
+		m.expiry = expiry
+	}
+	m.refreshErr = err
+	m.refreshing = nil
+	close(done)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Invalidate drops token if it is still the cached one, forcing the next call
+// to Token to log in again. Used after the API rejects a token with 401.
+func (m *TokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == token {
+		m.token = ""
+		m.expiry = 0
+	}
+}
+
+// Expired reports whether the cached token is missing or past its expiry.
+func (m *TokenManager) Expired() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.expiry == 0 {
+		return true // treat unset expiry as expired
+	}
+	return time.Now().Unix() >= m.expiry
+}
+
+// fresh reports whether the cached token can be used without refreshing.
+// Callers must hold m.mu.
+func (m *TokenManager) fresh() bool {
+	if m.token == "" || m.expiry == 0 {
+		return false
+	}
+	return time.Now().Add(tokenRefreshMargin).Unix() < m.expiry
+}
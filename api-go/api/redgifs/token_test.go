@@ -0,0 +1,187 @@
+package redgifs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLogin hands out numbered tokens valid for validFor, after waiting
+// for release if it's set.
+type countingLogin struct {
+	calls    atomic.Int32
+	validFor time.Duration
+	release  chan struct{}
+}
+
+func (l *countingLogin) login(ctx context.Context) (string, int64, error) {
+	n := l.calls.Add(1)
+	if l.release != nil {
+		select {
+		case <-l.release:
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+	}
+	return "token" + strconv.Itoa(int(n)), time.Now().Add(l.validFor).Unix(), nil
+}
+
+func TestReloginOnUnauthorized(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		// Only the second login's token is accepted.
+		if !strings.HasSuffix(token, ".2") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(gifJSON))
+	})
+	if _, err := testClient(f).GetGif(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.logins.Load(); got != 2 {
+		t.Errorf("logged in %d times, want 2", got)
+	}
+	if got := f.requests.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestUnauthorizedAfterRelogin(t *testing.T) {
+	f := newFakeRedgifs(t, func(w http.ResponseWriter, token string, attempt int) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	_, err := testClient(f).GetGif(context.Background(), "abc")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got %v, want unauthorized", err)
+	}
+	// 401 isn't retried: one re-login, then the error.
+	if got := f.logins.Load(); got != 2 {
+		t.Errorf("logged in %d times, want 2", got)
+	}
+}
+
+func TestTokenSharesLogin(t *testing.T) {
+	m := &TokenManager{}
+	l := &countingLogin{validFor: time.Hour, release: make(chan struct{})}
+
+	const callers = 20
+	tokens := make([]string, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Go(func() {
+			token, err := m.Token(context.Background(), l.login)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens[i] = token
+		})
+	}
+	// Let every caller reach Token before the login finishes.
+	time.Sleep(20 * time.Millisecond)
+	close(l.release)
+	wg.Wait()
+
+	if got := l.calls.Load(); got != 1 {
+		t.Errorf("logged in %d times, want 1", got)
+	}
+	for i, token := range tokens {
+		if token != "token1" {
+			t.Errorf("caller %d got %q, want token1", i, token)
+		}
+	}
+	if token, _ := m.Token(context.Background(), l.login); token != "token1" || l.calls.Load() != 1 {
+		t.Errorf("cached token not reused: got %q after %d logins", token, l.calls.Load())
+	}
+}
+
+func TestTokenRefreshesBeforeExpiry(t *testing.T) {
+	m := &TokenManager{}
+	// Valid, but within the refresh margin.
+	l := &countingLogin{validFor: tokenRefreshMargin / 2}
+	m.Token(context.Background(), l.login)
+	if m.Expired() {
+		t.Error("token expired straight away")
+	}
+	if token, _ := m.Token(context.Background(), l.login); token != "token2" {
+		t.Errorf("got %q, want a new token close to expiry", token)
+	}
+}
+
+func TestTokenLoginErrors(t *testing.T) {
+	m := &TokenManager{}
+	errLogin := errors.New("test: login failed")
+	calls := 0
+	failing := func(ctx context.Context) (string, int64, error) {
+		calls++
+		return "", 0, errLogin
+	}
+	if _, err := m.Token(context.Background(), failing); !errors.Is(err, errLogin) {
+		t.Fatalf("got %v, want the login error", err)
+	}
+	// Failures aren't cached.
+	m.Token(context.Background(), failing)
+	if calls != 2 {
+		t.Errorf("logged in %d times, want 2", calls)
+	}
+	if !m.Expired() {
+		t.Error("no token, but not expired")
+	}
+}
+
+func TestTokenWaiterOutlivesCancelledLogin(t *testing.T) {
+	m := &TokenManager{}
+	l := &countingLogin{validFor: time.Hour, release: make(chan struct{})}
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := m.Token(first, l.login)
+		firstErr <- err
+	}()
+	for l.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan string)
+	go func() {
+		token, err := m.Token(context.Background(), l.login)
+		if err != nil {
+			t.Error(err)
+		}
+		second <- token
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The caller logging in gives up; the one waiting on it logs in itself.
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v", err)
+	}
+	close(l.release)
+	if token := <-second; token != "token2" {
+		t.Errorf("waiting caller got %q, want token2", token)
+	}
+}
+
+func TestTokenInvalidate(t *testing.T) {
+	m := &TokenManager{}
+	l := &countingLogin{validFor: time.Hour}
+	m.Token(context.Background(), l.login)
+
+	// A stale token being rejected doesn't drop a newer one.
+	m.Invalidate("token0")
+	if token, _ := m.Token(context.Background(), l.login); token != "token1" {
+		t.Errorf("got %q after invalidating another token, want token1", token)
+	}
+	m.Invalidate("token1")
+	if !m.Expired() {
+		t.Error("invalidated token not expired")
+	}
+	if token, _ := m.Token(context.Background(), l.login); token != "token2" {
+		t.Errorf("got %q after invalidating, want token2", token)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultProvider is used for rows and requests that don't name a provider.
+const DefaultProvider = "redgifs"
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]MediaSearcher{}
+)
+
+// Register makes a provider available under its Name, replacing any
+// provider already registered with that name.
+func Register(provider MediaSearcher) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[provider.Name()] = provider
+}
+
+// Get returns the provider registered as name. An empty name means
+// DefaultProvider.
+func Get(name string) (MediaSearcher, bool) {
+	if name == "" {
+		name = DefaultProvider
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	provider, ok := registry[name]
+	return provider, ok
+}
+
+// Providers returns every registered provider, DefaultProvider first and the
+// rest by name.
+func Providers() []MediaSearcher {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	providers := make([]MediaSearcher, 0, len(registry))
+	for _, provider := range registry {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		if providers[i].Name() == DefaultProvider {
+			return true
+		}
+		if providers[j].Name() == DefaultProvider {
+			return false
+		}
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
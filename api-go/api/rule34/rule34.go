@@ -0,0 +1,33 @@
+package rule34
+
+import (
+	"kannonfoundry/api-go/api/booru"
+	"os"
+)
+
+const (
+	// ProviderName is the registry key for Rule34. Feed video ids are
+	// "rule34_<id>".
+	ProviderName   = "rule34"
+	DefaultBaseURL = "https://api.rule34.xxx"
+)
+
+// Config describes rule34.xxx as a Gelbooru instance. Credentials come from
+// the RULE34_USER_ID and RULE34_API_KEY environment variables.
+func Config() booru.Config {
+	return booru.Config{
+		Name:        ProviderName,
+		DisplayName: "Rule34",
+		Flavor:      booru.Gelbooru,
+		BaseURL:     DefaultBaseURL,
+		// The JSON output has no created_at, only the last edit time.
+		Format: booru.XML,
+		Login:  os.Getenv("RULE34_USER_ID"),
+		APIKey: os.Getenv("RULE34_API_KEY"),
+	}
+}
+
+// NewProvider creates a Rule34 provider; opts configure its client.
+func NewProvider(opts ...booru.Option) *booru.Provider {
+	return booru.NewProvider(Config(), opts...)
+}
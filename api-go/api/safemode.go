@@ -0,0 +1,34 @@
+package api
+
+import "strings"
+
+// Safe mode placeholders, served from assets/.
+const (
+	PlaceholderVideoURL = "/assets/safe-mode/placeholder.mp4"
+	PlaceholderImageURL = "/assets/safe-mode/placeholder.svg"
+)
+
+// UsePlaceholders points files' media at the safe mode placeholders. Files
+// proxied through /rgp/ are left alone: their URLs are marked for safe mode
+// (see redgifs.FormatFileUrls) and the proxy answers them with the same
+// placeholders.
+func UsePlaceholders(files []FileToSend) {
+	for i, file := range files {
+		media := PlaceholderVideoURL
+		if file.IsImage {
+			media = PlaceholderImageURL
+		}
+		files[i].URL = placeholder(file.URL, media)
+		files[i].HDURL = placeholder(file.HDURL, media)
+		files[i].SDURL = placeholder(file.SDURL, media)
+		files[i].PosterURL = placeholder(file.PosterURL, PlaceholderImageURL)
+		files[i].ThumbnailURL = placeholder(file.ThumbnailURL, PlaceholderImageURL)
+	}
+}
+
+func placeholder(u, replacement string) string {
+	if u == "" || strings.HasPrefix(u, "/rgp/") {
+		return u
+	}
+	return replacement
+}
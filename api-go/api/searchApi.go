@@ -1,13 +1,160 @@
 package api
 
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// FileToSend is a single media item returned by a provider. URL is the
+// preferred playback URL; the remaining fields are optional metadata.
 type FileToSend struct {
 	Name      string
 	URL       string
 	Username  string
 	CreatedAt int64
+	Provider  string
+
+	HDURL        string
+	SDURL        string
+	PosterURL    string
+	ThumbnailURL string
+	Tags         []string
+	Duration     float64 // seconds
+	Width        int
+	Height       int
+	Views        int64
+	Likes        int64
+	HasAudio     bool
+	Verified     bool
+	IsImage      bool
+}
+
+// Creator is a user profile on a provider.
+type Creator struct {
+	Username        string
+	Description     string
+	ProfileImageURL string
+	Followers       int64
+	Items           int64
+	Verified        bool
+}
+
+// Tag is a canonical tag name with the number of items carrying it.
+type Tag struct {
+	Name  string
+	Count int64
+}
+
+// Query is a tag search. Providers ignore the fields they don't support.
+type Query struct {
+	Tags         []string
+	Order        string
+	MediaType    string
+	VerifiedOnly bool
+	MinDuration  float64 // seconds
+	Rating       string  // one of Ratings' values; "" for any
+	Count        int
+	Cursor       string // "" for the first page
+}
+
+// Page is one page of results. Next is the cursor for the following page and
+// is empty when there are no more results.
+type Page struct {
+	Files []FileToSend
+	Next  string
+}
+
+// Order is a sort order a provider offers for tag search.
+type Order struct {
+	Value string
+	Label string
+}
+
+// Capabilities describes which MediaSearcher methods a provider supports.
+// Unsupported methods return ErrUnsupported.
+type Capabilities struct {
+	TagSearch      bool
+	TagSuggest     bool
+	CreatorSearch  bool
+	CreatorProfile bool
+	CreatorItems   bool
+	SingleItem     bool
+	Ratings        bool
+	Folders        bool // implements FolderSource
+	Orders         []Order
+	MediaTypes     []Order // values Query.MediaType takes; empty if ignored
+	VerifiedOnly   bool    // honours Query.VerifiedOnly
+	MinDuration    bool    // honours Query.MinDuration
+}
+
+// Ratings are the content ratings a Query can filter by. A leading "-"
+// excludes the rating instead. Providers with Capabilities.Ratings map them
+// onto their own rating scheme.
+var Ratings = []Order{
+	{Value: "", Label: "Any rating"},
+	{Value: "safe", Label: "Safe"},
+	{Value: "questionable", Label: "Questionable"},
+	{Value: "explicit", Label: "Explicit"},
+	{Value: "-explicit", Label: "Not explicit"},
 }
 
+// MediaSearcher is a media source such as Redgifs or Rule34. Implementations
+// are registered by name with Register and looked up with Get.
 type MediaSearcher interface {
-	Search(tags []string) (files []FileToSend, err error)
-	FormatAndModifySearch(tags []string, authorID int64) (searchTerm string, err error)
+	// Name is the registry key, stored with subscriptions and feed items.
+	Name() string
+	// DisplayName is shown to users, e.g. in the search form.
+	DisplayName() string
+	Capabilities() Capabilities
+
+	// ParseTags splits user input or a stored search term into tags.
+	ParseTags(query string) []string
+	// SearchTerm joins tags into the form stored on a tag subscription.
+	SearchTerm(tags []string) string
+
+	SearchTags(ctx context.Context, q Query) (Page, error)
+	SuggestTags(ctx context.Context, query string, count int) ([]Tag, error)
+	SearchCreators(ctx context.Context, query string, count int, cursor string) ([]Creator, string, error)
+	GetCreator(ctx context.Context, username string) (*Creator, error)
+	// CreatorItems lists a creator's items, newest first.
+	CreatorItems(ctx context.Context, username string, count int, cursor string) (Page, error)
+	GetItem(ctx context.Context, id string) (*FileToSend, error)
+}
+
+// FolderSource is implemented by providers whose items live in folders, such
+// as the local media library. Folder subscriptions follow a folder and
+// everything below it.
+type FolderSource interface {
+	// FolderItems lists the items in folder and its subfolders, newest
+	// first. The root folder is "".
+	FolderItems(ctx context.Context, folder string, count int, cursor string) (Page, error)
+}
+
+// PageCursor encodes a 1-based page number as a cursor, for providers that
+// page by number.
+func PageCursor(page int) string {
+	return strconv.Itoa(page)
+}
+
+// CursorPage decodes a cursor made by PageCursor; "" or junk is page 1.
+func CursorPage(cursor string) int {
+	page, err := strconv.Atoi(cursor)
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// SplitTags splits a free-text search into tags on commas and "|", for
+// providers whose tags may contain spaces, so "Strap On, Gay" searches for
+// both tags rather than one literal tag.
+func SplitTags(query string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(query, func(r rune) bool { return r == ',' || r == '|' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
@@ -0,0 +1,32 @@
+package api
+
+// Wrapper is implemented by providers that decorate another provider, such
+// as the response cache.
+type Wrapper interface {
+	Unwrap() MediaSearcher
+}
+
+// StatsReporter is implemented by provider wrappers that keep counters for
+// operators. Stats returns JSON-encodable values keyed by what they
+// describe, e.g. "cache".
+type StatsReporter interface {
+	Stats() map[string]any
+}
+
+// ProviderStats merges the stats of every wrapper around provider.
+func ProviderStats(provider MediaSearcher) map[string]any {
+	stats := map[string]any{}
+	for provider != nil {
+		if reporter, ok := provider.(StatsReporter); ok {
+			for key, value := range reporter.Stats() {
+				stats[key] = value
+			}
+		}
+		wrapper, ok := provider.(Wrapper)
+		if !ok {
+			break
+		}
+		provider = wrapper.Unwrap()
+	}
+	return stats
+}
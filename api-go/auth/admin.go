@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// IsAdmin reports whether u is one of the operators listed, comma
+// separated, in the ADMIN_USERS environment variable.
+func IsAdmin(u User) bool {
+	if u.IsEmpty() {
+		return false
+	}
+	return slices.Contains(strings.Split(os.Getenv("ADMIN_USERS"), ","), u.Username)
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultSafeMode reports whether safe mode is on for visitors and for users
+// who haven't chosen: SAFE_MODE=true, or the older SFW=true.
+func DefaultSafeMode() bool {
+	return os.Getenv("SAFE_MODE") == "true" || os.Getenv("SFW") == "true"
+}
+
+// InSafeMode reports whether media should be replaced with placeholders and
+// thumbnails blurred for u.
+func (u User) InSafeMode() bool {
+	if u.SafeMode != nil {
+		return *u.SafeMode
+	}
+	return DefaultSafeMode()
+}
+
+// SafeMode reports whether the request's user, or a visitor, is in safe mode.
+func SafeMode(r *http.Request) bool {
+	return IsLoggedIn(r).InSafeMode()
+}
+
+// SetSafeMode stores a user's safe mode choice.
+func SetSafeMode(ctx context.Context, db *pgxpool.Pool, userID string, on bool) error {
+	_, err := db.Exec(ctx, `UPDATE users SET safe_mode = $2 WHERE id = $1`, userID, on)
+	if err != nil {
+		return fmt.Errorf("failed to update safe mode: %w", err)
+	}
+	return nil
+}
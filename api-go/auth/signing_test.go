@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signed(t *testing.T, host, path string, safe bool) url.Values {
+	t.Helper()
+	query, err := url.ParseQuery(SignProxyURL(host, path, safe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestVerifyProxyURL(t *testing.T) {
+	t.Setenv("SECRET_KEY", "test secret")
+	for _, safe := range []bool{false, true} {
+		query := signed(t, "media", "Abc Def.mp4", safe)
+		if got := query.Get("h"); got != "media" {
+			t.Errorf("h = %q, want media", got)
+		}
+		if err := VerifyProxyURL("media", "Abc Def.mp4", query); err != nil {
+			t.Errorf("safe %v: %v", safe, err)
+		}
+	}
+
+	expires, err := strconv.ParseInt(signed(t, "media", "Abc.mp4", false).Get("e"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid := time.Until(time.Unix(expires, 0)); valid < ProxyURLLifetime || valid > ProxyURLLifetime+proxyURLWindow {
+		t.Errorf("valid for %s, want %s to %s", valid, ProxyURLLifetime, ProxyURLLifetime+proxyURLWindow)
+	}
+}
+
+func TestVerifyProxyURLRejects(t *testing.T) {
+	t.Setenv("SECRET_KEY", "test secret")
+	unsafe := func() url.Values { return signed(t, "media", "Abc.mp4", false) }
+	safe := func() url.Values { return signed(t, "media", "Abc.mp4", true) }
+
+	noSignature := unsafe()
+	noSignature.Del("s")
+	noExpiry := unsafe()
+	noExpiry.Del("e")
+	extended := unsafe()
+	extended.Set("e", strconv.FormatInt(time.Now().Add(365*24*time.Hour).Unix(), 10))
+	unsafeMade := safe()
+	unsafeMade.Del("sfw")
+	safeMade := unsafe()
+	safeMade.Set("sfw", "1")
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	expired := url.Values{"h": {"media"}, "e": {past}, "s": {proxySignature(proxyKey(), "media", "Abc.mp4", past, "")}}
+
+	tests := []struct {
+		name  string
+		host  string
+		path  string
+		query url.Values
+		want  error
+	}{
+		{"unsigned", "media", "Abc.mp4", url.Values{"h": {"media"}}, ErrUnsigned},
+		{"no signature", "media", "Abc.mp4", noSignature, ErrUnsigned},
+		{"no expiry", "media", "Abc.mp4", noExpiry, ErrUnsigned},
+		{"other path", "media", "Other.mp4", unsafe(), ErrBadSignature},
+		{"other host", "thumbs", "Abc.mp4", unsafe(), ErrBadSignature},
+		{"extended", "media", "Abc.mp4", extended, ErrBadSignature},
+		{"sfw removed", "media", "Abc.mp4", unsafeMade, ErrBadSignature},
+		{"sfw added", "media", "Abc.mp4", safeMade, ErrBadSignature},
+		{"expired", "media", "Abc.mp4", expired, ErrExpired},
+	}
+	for _, tt := range tests {
+		if err := VerifyProxyURL(tt.host, tt.path, tt.query); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyProxyURLKey(t *testing.T) {
+	t.Setenv("SECRET_KEY", "old secret")
+	query := signed(t, "media", "Abc.mp4", false)
+
+	// Rotating the secret invalidates every URL signed with the old one.
+	t.Setenv("SECRET_KEY", "new secret")
+	if err := VerifyProxyURL("media", "Abc.mp4", query); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("URL signed with the old secret: got %v", err)
+	}
+
+	// Without a secret nothing is signed and nothing verifies.
+	t.Setenv("SECRET_KEY", "")
+	query = signed(t, "media", "Abc.mp4", false)
+	if query.Has("e") || query.Has("s") {
+		t.Errorf("signed %v without a secret", query)
+	}
+	query.Set("e", "1")
+	query.Set("s", "x")
+	if err := VerifyProxyURL("media", "Abc.mp4", query); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("without a secret: got %v", err)
+	}
+}
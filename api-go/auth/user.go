@@ -27,6 +27,9 @@ func IsLoggedIn(r *http.Request) User {
 type User struct {
 	Id       string
 	Username string
+	// SafeMode is the user's safe mode choice; nil follows the instance
+	// default (see InSafeMode).
+	SafeMode *bool `json:",omitempty"`
 }
 
 func (u User) IsEmpty() bool {
@@ -58,6 +61,22 @@ func CreateUserCookie(user User) (string, error) {
 	return EncryptCookie(string(jsonData))
 }
 
+// SetSessionCookie logs user in on w, replacing any session cookie.
+func SetSessionCookie(w http.ResponseWriter, user User) error {
+	cookie, err := CreateUserCookie(user)
+	if err != nil {
+		return fmt.Errorf("failed to create cookie: %w", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    cookie,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   86400 * 7, // 7 days
+	})
+	return nil
+}
+
 func newUserFromCookie(cookie string) User {
 	decryptedData, err := DecryptCookie(cookie)
 	if err != nil {
@@ -38,13 +38,13 @@ func CreateUser(db *pgxpool.Pool, username, password string) (*User, error) {
 
 // AuthenticateUser validates username/password and returns user if valid
 func AuthenticateUser(db *pgxpool.Pool, username, password string) (*User, error) {
-	query := `SELECT id, username, password_hash FROM users WHERE username = $1`
+	query := `SELECT id, username, password_hash, safe_mode FROM users WHERE username = $1`
 
 	var user User
 	var passwordHash string
 
 	err := db.QueryRow(context.Background(), query, username).Scan(
-		&user.Id, &user.Username, &passwordHash,
+		&user.Id, &user.Username, &passwordHash, &user.SafeMode,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
@@ -0,0 +1,31 @@
+package layout
+
+import (
+	"fmt"
+	"time"
+)
+
+// formatDuration renders seconds as m:ss.
+func formatDuration(seconds float64) string {
+	total := int(seconds + 0.5)
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// formatCount abbreviates large counts, e.g. 12345 -> "12.3K".
+func formatCount(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fK", float64(n)/1_000)
+	}
+	return fmt.Sprint(n)
+}
+
+// formatDate renders a unix timestamp as a calendar date.
+func formatDate(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).Format("Jan 2, 2006")
+}
@@ -0,0 +1,44 @@
+package components
+
+import (
+	"kannonfoundry/api-go/api"
+	"net/url"
+)
+
+// providerQuery is the ?provider= suffix for links to pages that default to
+// api.DefaultProvider, so Redgifs links stay as they were.
+func providerQuery(provider string) string {
+	if provider == "" || provider == api.DefaultProvider {
+		return ""
+	}
+	return "?provider=" + url.QueryEscape(provider)
+}
+
+// CreatorURL links to a creator's page on provider.
+func CreatorURL(provider, username string) string {
+	return "/creators/" + url.PathEscape(username) + providerQuery(provider)
+}
+
+// CreatorSubscribeURL is the endpoint toggling a creator subscription.
+func CreatorSubscribeURL(provider, username string) string {
+	return "/creators/" + url.PathEscape(username) + "/subscribe" + providerQuery(provider)
+}
+
+// VideoURL links to a file's detail page, or returns "" when its provider
+// can't look up single items.
+func VideoURL(file api.FileToSend) string {
+	if !supports(file.Provider, func(c api.Capabilities) bool { return c.SingleItem }) {
+		return ""
+	}
+	return "/videos/" + url.PathEscape(file.Name) + providerQuery(file.Provider)
+}
+
+// HasCreatorPage reports whether provider has creator pages to link to.
+func HasCreatorPage(provider string) bool {
+	return supports(provider, func(c api.Capabilities) bool { return c.CreatorProfile })
+}
+
+func supports(provider string, capability func(api.Capabilities) bool) bool {
+	p, ok := api.Get(provider)
+	return ok && capability(p.Capabilities())
+}
@@ -22,6 +22,13 @@ CREATE TABLE IF NOT EXISTS feed_subscriptions (
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
+-- Subscription provider (added after initial release). Rule34 tag
+-- subscriptions were briefly stored as type 'rule34'.
+ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'redgifs';
+ALTER TABLE feed_subscriptions DROP CONSTRAINT IF EXISTS feed_subscriptions_type_check;
+UPDATE feed_subscriptions SET provider = 'rule34', type = 'tag' WHERE type = 'rule34';
+ALTER TABLE feed_subscriptions ADD CONSTRAINT feed_subscriptions_type_check CHECK (type IN ('tag', 'creator', 'folder'));
+
 CREATE INDEX IF NOT EXISTS idx_feed_subscriptions_user_id ON feed_subscriptions(user_id);
 CREATE INDEX IF NOT EXISTS idx_feed_subscriptions_is_initialized ON feed_subscriptions(is_initialized);
 
@@ -41,3 +48,47 @@ CREATE TABLE IF NOT EXISTS feed_items (
 CREATE INDEX IF NOT EXISTS idx_feed_items_user_timestamp ON feed_items(user_id, timestamp DESC);
 CREATE INDEX IF NOT EXISTS idx_feed_items_subscription ON feed_items(subscription_id);
 CREATE INDEX IF NOT EXISTS idx_feed_items_created_at ON feed_items(created_at);
+
+-- Feed item metadata (added after initial release)
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS hd_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS poster_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS has_audio BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Feed item provider (added after initial release)
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'redgifs';
+UPDATE feed_items SET provider = 'rule34' WHERE video_id LIKE 'rule34\_%' AND provider <> 'rule34';
+
+-- Feed item rendition URLs and counters (added after initial release)
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS sd_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS thumbnail_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS views BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS likes BIGINT NOT NULL DEFAULT 0;
+
+-- Feed item media type (added after initial release)
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS is_image BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Local media library index (files under LIBRARY_DIR, default files/)
+CREATE TABLE IF NOT EXISTS library_items (
+    id BIGSERIAL PRIMARY KEY,
+    path TEXT NOT NULL UNIQUE,
+    folder TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    mod_time TIMESTAMP NOT NULL,
+    duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    is_image BOOLEAN NOT NULL DEFAULT FALSE,
+    indexed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_items_folder ON library_items(folder);
+CREATE INDEX IF NOT EXISTS idx_library_items_mod_time ON library_items(mod_time DESC);
+CREATE INDEX IF NOT EXISTS idx_library_items_tags ON library_items USING GIN(tags);
+
+-- Per-user safe mode (added after initial release). NULL follows the
+-- instance default set by SAFE_MODE.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS safe_mode BOOLEAN;
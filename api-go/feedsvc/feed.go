@@ -8,16 +8,18 @@ import (
 )
 
 // GetUserFeed retrieves paginated feed items for a user
-func GetUserFeed(db *pgxpool.Pool, userID string, limit, offset int) ([]VideoItem, error) {
+func GetUserFeed(ctx context.Context, db *pgxpool.Pool, userID string, limit, offset int) ([]VideoItem, error) {
 	query := `
-		SELECT id, video_id, url, username, timestamp
+		SELECT id, video_id, url, username, timestamp,
+			hd_url, poster_url, tags, duration, width, height, has_audio, verified, provider,
+			sd_url, thumbnail_url, views, likes, is_image
 		FROM feed_items
 		WHERE user_id = $1
 		ORDER BY timestamp DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := db.Query(context.Background(), query, userID, limit, offset)
+	rows, err := db.Query(ctx, query, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query feed items: %w", err)
 	}
@@ -26,7 +28,11 @@ func GetUserFeed(db *pgxpool.Pool, userID string, limit, offset int) ([]VideoIte
 	var items []VideoItem
 	for rows.Next() {
 		var item VideoItem
-		err := rows.Scan(&item.Id, &item.VideoId, &item.Url, &item.Username, &item.Timestamp)
+		err := rows.Scan(&item.Id, &item.VideoId, &item.Url, &item.Username, &item.Timestamp,
+			&item.HdUrl, &item.PosterUrl, &item.Tags, &item.Duration,
+			&item.Width, &item.Height, &item.HasAudio, &item.Verified, &item.Provider,
+			&item.SdUrl, &item.ThumbnailUrl, &item.Views, &item.Likes, &item.IsImage,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan feed item: %w", err)
 		}
@@ -41,11 +47,11 @@ func GetUserFeed(db *pgxpool.Pool, userID string, limit, offset int) ([]VideoIte
 }
 
 // GetUserFeedCount returns the total number of feed items for a user
-func GetUserFeedCount(db *pgxpool.Pool, userID string) (int, error) {
+func GetUserFeedCount(ctx context.Context, db *pgxpool.Pool, userID string) (int, error) {
 	query := `SELECT COUNT(*) FROM feed_items WHERE user_id = $1`
 
 	var count int
-	err := db.QueryRow(context.Background(), query, userID).Scan(&count)
+	err := db.QueryRow(ctx, query, userID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count feed items: %w", err)
 	}
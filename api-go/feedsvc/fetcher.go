@@ -4,40 +4,57 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"kannonfoundry/api-go/api"
-	"kannonfoundry/api-go/api/redgifs"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type VideoItem struct {
-	Id        string
-	VideoId   string
-	Url       string
-	Username  string
-	Timestamp time.Time
+	Id           string
+	Provider     string
+	VideoId      string
+	Url          string
+	Username     string
+	Timestamp    time.Time
+	HdUrl        string
+	SdUrl        string
+	PosterUrl    string
+	ThumbnailUrl string
+	Tags         []string
+	Duration     float64
+	Width        int
+	Height       int
+	Views        int64
+	Likes        int64
+	HasAudio     bool
+	Verified     bool
+	IsImage      bool
 }
 
 // FetchAndStore fetches new videos for a subscription and stores them in the database
-func FetchAndStore(db *pgxpool.Pool, subscription *Subscription, rgClient *redgifs.RedGifsClient) error {
+func FetchAndStore(ctx context.Context, db *pgxpool.Pool, subscription *Subscription) error {
+	provider, ok := api.Get(subscription.Provider)
+	if !ok {
+		return fmt.Errorf("%w: %q", api.ErrUnknownProvider, subscription.Provider)
+	}
+
 	var videos []VideoItem
 	var err error
 
 	// Determine fetch strategy based on initialization status
 	if !subscription.IsInitialized {
 		// First time fetch: get initial 20 items
-		videos, err = fetchInitialVideos(subscription, rgClient)
+		videos, err = fetchInitialVideos(ctx, subscription, provider)
 		if err != nil {
 			return fmt.Errorf("failed to fetch initial videos: %w", err)
 		}
 
 		// Mark as initialized and set last_video_id to the newest video
 		if len(videos) > 0 {
-			if err := markSubscriptionInitialized(db, subscription.Id, videos[0].VideoId); err != nil {
+			if err := markSubscriptionInitialized(ctx, db, subscription.Id, videos[0].VideoId); err != nil {
 				return fmt.Errorf("failed to mark subscription as initialized: %w", err)
 			}
 			subscription.IsInitialized = true
@@ -45,14 +62,14 @@ func FetchAndStore(db *pgxpool.Pool, subscription *Subscription, rgClient *redgi
 		}
 	} else {
 		// Regular fetch: get new videos since last check
-		videos, err = fetchNewVideos(subscription, rgClient)
+		videos, err = fetchNewVideos(ctx, subscription, provider)
 		if err != nil {
 			return fmt.Errorf("failed to fetch new videos: %w", err)
 		}
 
 		// Update last_video_id if we got new videos
 		if len(videos) > 0 {
-			if err := updateLastVideoId(db, subscription.Id, videos[0].VideoId); err != nil {
+			if err := updateLastVideoId(ctx, db, subscription.Id, videos[0].VideoId); err != nil {
 				return fmt.Errorf("failed to update last video id: %w", err)
 			}
 			subscription.LastVideoId = &videos[0].VideoId
@@ -61,7 +78,7 @@ func FetchAndStore(db *pgxpool.Pool, subscription *Subscription, rgClient *redgi
 
 	// Store videos in database
 	if len(videos) > 0 {
-		if err := storeVideos(db, subscription, videos); err != nil {
+		if err := storeVideos(ctx, db, subscription, videos); err != nil {
 			return fmt.Errorf("failed to store videos: %w", err)
 		}
 		log.Printf("Stored %d new videos for subscription %s (%s: %s)", len(videos), subscription.Id, subscription.Type, subscription.SearchTerm)
@@ -71,54 +88,56 @@ func FetchAndStore(db *pgxpool.Pool, subscription *Subscription, rgClient *redgi
 }
 
 // fetchInitialVideos gets the first 20 videos for a new subscription
-func fetchInitialVideos(subscription *Subscription, rgClient *redgifs.RedGifsClient) ([]VideoItem, error) {
-	if subscription.Type == "creator" {
+func fetchInitialVideos(ctx context.Context, subscription *Subscription, provider api.MediaSearcher) ([]VideoItem, error) {
+	page, err := fetchPage(ctx, subscription, provider, "")
+	if err != nil {
+		return nil, err
+	}
+	return apiFilesToVideoItems(page.Files), nil
+}
+
+// fetchPage gets one page of newest videos for a subscription from its provider
+func fetchPage(ctx context.Context, subscription *Subscription, provider api.MediaSearcher, cursor string) (api.Page, error) {
+	switch subscription.Type {
+	case "creator":
 		// Search by user
-		files, err := rgClient.SearchByUser(subscription.SearchTerm, 20, 1)
-		if err != nil {
-			return nil, err
+		return provider.CreatorItems(ctx, subscription.SearchTerm, 20, cursor)
+	case "folder":
+		folders, ok := provider.(api.FolderSource)
+		if !ok {
+			return api.Page{}, fmt.Errorf("%s: %w: folder subscriptions", provider.Name(), api.ErrUnsupported)
 		}
-		return apiFilesToVideoItems(files), nil
-	} else {
-		// Tag search
-		tags := strings.Split(subscription.SearchTerm, "|")
-		files, err := rgClient.Search(tags, 20, 1)
-		if err != nil {
-			return nil, err
-		}
-		return apiFilesToVideoItems(files), nil
+		return folders.FolderItems(ctx, subscription.SearchTerm, 20, cursor)
 	}
+	// Tag search
+	return provider.SearchTags(ctx, api.Query{
+		Tags:   provider.ParseTags(subscription.SearchTerm),
+		Count:  20,
+		Cursor: cursor,
+	})
 }
 
 // fetchNewVideos gets videos since the last check, stopping when we find last_video_id
-func fetchNewVideos(subscription *Subscription, rgClient *redgifs.RedGifsClient) ([]VideoItem, error) {
+func fetchNewVideos(ctx context.Context, subscription *Subscription, provider api.MediaSearcher) ([]VideoItem, error) {
 	var allVideos []VideoItem
-	page := 1
+	cursor := ""
 	maxPages := 5 // Safety limit to prevent infinite loops
 
-	for page <= maxPages {
-		var files []api.FileToSend
-		var err error
-
-		if subscription.Type == "creator" {
-			files, err = rgClient.SearchByUser(subscription.SearchTerm, 20, page)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			tags := strings.Split(subscription.SearchTerm, "|")
-			files, err = rgClient.Search(tags, 20, page)
-			if err != nil {
-				return nil, err
-			}
+	for pages := 0; pages < maxPages; pages++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := fetchPage(ctx, subscription, provider, cursor)
+		if err != nil {
+			return nil, err
 		}
 
-		if len(files) == 0 {
+		if len(page.Files) == 0 {
 			break // No more results
 		}
 
 		// Process files and check for last_video_id
-		for _, file := range files {
+		for _, file := range page.Files {
 			videoId := file.Name
 
 			// Stop if we've reached the last seen video
@@ -126,15 +145,13 @@ func fetchNewVideos(subscription *Subscription, rgClient *redgifs.RedGifsClient)
 				return allVideos, nil
 			}
 
-			allVideos = append(allVideos, VideoItem{
-				VideoId:   videoId,
-				Url:       file.URL,
-				Username:  file.Username,
-				Timestamp: time.Unix(file.CreatedAt, 0),
-			})
+			allVideos = append(allVideos, apiFileToVideoItem(file))
 		}
 
-		page++
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
 	}
 
 	return allVideos, nil
@@ -144,29 +161,81 @@ func fetchNewVideos(subscription *Subscription, rgClient *redgifs.RedGifsClient)
 func apiFilesToVideoItems(files []api.FileToSend) []VideoItem {
 	var videos []VideoItem
 	for _, file := range files {
-		videos = append(videos, VideoItem{
-			VideoId:   file.Name,
-			Url:       file.URL,
-			Username:  file.Username,
-			Timestamp: time.Unix(file.CreatedAt, 0),
-		})
+		videos = append(videos, apiFileToVideoItem(file))
 	}
 	return videos
 }
 
+// apiFileToVideoItem converts a single API FileToSend to a VideoItem
+func apiFileToVideoItem(file api.FileToSend) VideoItem {
+	tags := file.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return VideoItem{
+		Provider:     file.Provider,
+		VideoId:      file.Name,
+		Url:          file.URL,
+		Username:     file.Username,
+		Timestamp:    time.Unix(file.CreatedAt, 0),
+		HdUrl:        file.HDURL,
+		SdUrl:        file.SDURL,
+		PosterUrl:    file.PosterURL,
+		ThumbnailUrl: file.ThumbnailURL,
+		Tags:         tags,
+		Duration:     file.Duration,
+		Width:        file.Width,
+		Height:       file.Height,
+		Views:        file.Views,
+		Likes:        file.Likes,
+		HasAudio:     file.HasAudio,
+		Verified:     file.Verified,
+		IsImage:      file.IsImage,
+	}
+}
+
+// ToFileToSend converts a stored feed item back to an API FileToSend
+func (v VideoItem) ToFileToSend() api.FileToSend {
+	return api.FileToSend{
+		Name:         v.VideoId,
+		Provider:     v.Provider,
+		URL:          v.Url,
+		Username:     v.Username,
+		CreatedAt:    v.Timestamp.Unix(),
+		HDURL:        v.HdUrl,
+		SDURL:        v.SdUrl,
+		PosterURL:    v.PosterUrl,
+		ThumbnailURL: v.ThumbnailUrl,
+		Tags:         v.Tags,
+		Duration:     v.Duration,
+		Width:        v.Width,
+		Height:       v.Height,
+		Views:        v.Views,
+		Likes:        v.Likes,
+		HasAudio:     v.HasAudio,
+		Verified:     v.Verified,
+		IsImage:      v.IsImage,
+	}
+}
+
 // storeVideos inserts videos into the database
-func storeVideos(db *pgxpool.Pool, subscription *Subscription, videos []VideoItem) error {
+func storeVideos(ctx context.Context, db *pgxpool.Pool, subscription *Subscription, videos []VideoItem) error {
 	query := `
-		INSERT INTO feed_items (id, subscription_id, user_id, video_id, url, username, timestamp)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO feed_items (id, subscription_id, user_id, video_id, url, username, timestamp,
+			hd_url, poster_url, tags, duration, width, height, has_audio, verified, provider,
+			sd_url, thumbnail_url, views, likes, is_image)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 		ON CONFLICT (subscription_id, video_id) DO NOTHING
 	`
 
 	for _, video := range videos {
 		id := uuid.New().String()
-		_, err := db.Exec(context.Background(), query,
+		_, err := db.Exec(ctx, query,
 			id, subscription.Id, subscription.UserId, video.VideoId,
 			video.Url, video.Username, video.Timestamp,
+			video.HdUrl, video.PosterUrl, video.Tags, video.Duration,
+			video.Width, video.Height, video.HasAudio, video.Verified, subscription.Provider,
+			video.SdUrl, video.ThumbnailUrl, video.Views, video.Likes, video.IsImage,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert video %s: %w", video.VideoId, err)
@@ -177,15 +246,15 @@ func storeVideos(db *pgxpool.Pool, subscription *Subscription, videos []VideoIte
 }
 
 // markSubscriptionInitialized marks a subscription as initialized
-func markSubscriptionInitialized(db *pgxpool.Pool, subscriptionId, lastVideoId string) error {
+func markSubscriptionInitialized(ctx context.Context, db *pgxpool.Pool, subscriptionId, lastVideoId string) error {
 	query := `UPDATE feed_subscriptions SET is_initialized = true, last_video_id = $1 WHERE id = $2`
-	_, err := db.Exec(context.Background(), query, lastVideoId, subscriptionId)
+	_, err := db.Exec(ctx, query, lastVideoId, subscriptionId)
 	return err
 }
 
 // updateLastVideoId updates the last_video_id for a subscription
-func updateLastVideoId(db *pgxpool.Pool, subscriptionId, lastVideoId string) error {
+func updateLastVideoId(ctx context.Context, db *pgxpool.Pool, subscriptionId, lastVideoId string) error {
 	query := `UPDATE feed_subscriptions SET last_video_id = $1 WHERE id = $2`
-	_, err := db.Exec(context.Background(), query, lastVideoId, subscriptionId)
+	_, err := db.Exec(ctx, query, lastVideoId, subscriptionId)
 	return err
 }
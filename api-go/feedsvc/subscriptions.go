@@ -12,30 +12,31 @@ import (
 type Subscription struct {
 	Id            string
 	UserId        string
-	Type          string // "tag" or "creator"
+	Provider      string // registry name of the api.MediaSearcher, e.g. "redgifs"
+	Type          string // "tag", "creator" or "folder"
 	SearchTerm    string
 	LastVideoId   *string
 	IsInitialized bool
 }
 
 // CreateSubscription adds a new feed subscription for a user
-func CreateSubscription(db *pgxpool.Pool, userID, subscriptionType, searchTerm string) (*Subscription, error) {
+func CreateSubscription(ctx context.Context, db *pgxpool.Pool, userID, provider, subscriptionType, searchTerm string) (*Subscription, error) {
 	// Idempotent: return existing subscription if present
-	if existing, err := GetSubscriptionByUserAndTerm(db, userID, subscriptionType, searchTerm); err == nil && existing != nil {
+	if existing, err := GetSubscriptionByUserAndTerm(ctx, db, userID, provider, subscriptionType, searchTerm); err == nil && existing != nil {
 		return existing, nil
 	}
 
 	id := uuid.New().String()
 
 	query := `
-		INSERT INTO feed_subscriptions (id, user_id, type, search_term, is_initialized)
-		VALUES ($1, $2, $3, $4, false)
-		RETURNING id, user_id, type, search_term, last_video_id, is_initialized
+		INSERT INTO feed_subscriptions (id, user_id, provider, type, search_term, is_initialized)
+		VALUES ($1, $2, $3, $4, $5, false)
+		RETURNING id, user_id, provider, type, search_term, last_video_id, is_initialized
 	`
 
 	sub := &Subscription{}
-	err := db.QueryRow(context.Background(), query, id, userID, subscriptionType, searchTerm).Scan(
-		&sub.Id, &sub.UserId, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized,
+	err := db.QueryRow(ctx, query, id, userID, provider, subscriptionType, searchTerm).Scan(
+		&sub.Id, &sub.UserId, &sub.Provider, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create subscription: %w", err)
@@ -45,10 +46,10 @@ func CreateSubscription(db *pgxpool.Pool, userID, subscriptionType, searchTerm s
 }
 
 // DeleteSubscription removes a feed subscription
-func DeleteSubscription(db *pgxpool.Pool, subscriptionID string) error {
+func DeleteSubscription(ctx context.Context, db *pgxpool.Pool, subscriptionID string) error {
 	query := `DELETE FROM feed_subscriptions WHERE id = $1`
 
-	result, err := db.Exec(context.Background(), query, subscriptionID)
+	result, err := db.Exec(ctx, query, subscriptionID)
 	if err != nil {
 		return fmt.Errorf("failed to delete subscription: %w", err)
 	}
@@ -61,15 +62,15 @@ func DeleteSubscription(db *pgxpool.Pool, subscriptionID string) error {
 }
 
 // ListUserSubscriptions retrieves all subscriptions for a user
-func ListUserSubscriptions(db *pgxpool.Pool, userID string) ([]Subscription, error) {
+func ListUserSubscriptions(ctx context.Context, db *pgxpool.Pool, userID string) ([]Subscription, error) {
 	query := `
-		SELECT id, user_id, type, search_term, last_video_id, is_initialized
+		SELECT id, user_id, provider, type, search_term, last_video_id, is_initialized
 		FROM feed_subscriptions
 		WHERE user_id = $1
 		ORDER BY created_at DESC
 	`
 
-	rows, err := db.Query(context.Background(), query, userID)
+	rows, err := db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
 	}
@@ -78,7 +79,7 @@ func ListUserSubscriptions(db *pgxpool.Pool, userID string) ([]Subscription, err
 	var subscriptions []Subscription
 	for rows.Next() {
 		var sub Subscription
-		err := rows.Scan(&sub.Id, &sub.UserId, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized)
+		err := rows.Scan(&sub.Id, &sub.UserId, &sub.Provider, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan subscription: %w", err)
 		}
@@ -93,14 +94,14 @@ func ListUserSubscriptions(db *pgxpool.Pool, userID string) ([]Subscription, err
 }
 
 // GetAllSubscriptions retrieves all subscriptions for the worker to process
-func GetAllSubscriptions(db *pgxpool.Pool) ([]Subscription, error) {
+func GetAllSubscriptions(ctx context.Context, db *pgxpool.Pool) ([]Subscription, error) {
 	query := `
-		SELECT id, user_id, type, search_term, last_video_id, is_initialized
+		SELECT id, user_id, provider, type, search_term, last_video_id, is_initialized
 		FROM feed_subscriptions
 		ORDER BY created_at ASC
 	`
 
-	rows, err := db.Query(context.Background(), query)
+	rows, err := db.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all subscriptions: %w", err)
 	}
@@ -109,7 +110,7 @@ func GetAllSubscriptions(db *pgxpool.Pool) ([]Subscription, error) {
 	var subscriptions []Subscription
 	for rows.Next() {
 		var sub Subscription
-		err := rows.Scan(&sub.Id, &sub.UserId, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized)
+		err := rows.Scan(&sub.Id, &sub.UserId, &sub.Provider, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan subscription: %w", err)
 		}
@@ -123,18 +124,18 @@ func GetAllSubscriptions(db *pgxpool.Pool) ([]Subscription, error) {
 	return subscriptions, nil
 }
 
-// GetSubscriptionByUserAndTerm fetches a single subscription for a user+type+term.
-func GetSubscriptionByUserAndTerm(db *pgxpool.Pool, userID, subscriptionType, searchTerm string) (*Subscription, error) {
+// GetSubscriptionByUserAndTerm fetches a single subscription for a user+provider+type+term.
+func GetSubscriptionByUserAndTerm(ctx context.Context, db *pgxpool.Pool, userID, provider, subscriptionType, searchTerm string) (*Subscription, error) {
 	query := `
-		SELECT id, user_id, type, search_term, last_video_id, is_initialized
+		SELECT id, user_id, provider, type, search_term, last_video_id, is_initialized
 		FROM feed_subscriptions
-		WHERE user_id = $1 AND type = $2 AND search_term = $3
+		WHERE user_id = $1 AND provider = $2 AND type = $3 AND search_term = $4
 		LIMIT 1
 	`
 
 	var sub Subscription
-	err := db.QueryRow(context.Background(), query, userID, subscriptionType, searchTerm).Scan(
-		&sub.Id, &sub.UserId, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized,
+	err := db.QueryRow(ctx, query, userID, provider, subscriptionType, searchTerm).Scan(
+		&sub.Id, &sub.UserId, &sub.Provider, &sub.Type, &sub.SearchTerm, &sub.LastVideoId, &sub.IsInitialized,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -145,14 +146,14 @@ func GetSubscriptionByUserAndTerm(db *pgxpool.Pool, userID, subscriptionType, se
 	return &sub, nil
 }
 
-// DeleteSubscriptionByUserAndTerm removes a subscription by user+type+term.
-func DeleteSubscriptionByUserAndTerm(db *pgxpool.Pool, userID, subscriptionType, searchTerm string) error {
+// DeleteSubscriptionByUserAndTerm removes a subscription by user+provider+type+term.
+func DeleteSubscriptionByUserAndTerm(ctx context.Context, db *pgxpool.Pool, userID, provider, subscriptionType, searchTerm string) error {
 	query := `
 		DELETE FROM feed_subscriptions
-		WHERE user_id = $1 AND type = $2 AND search_term = $3
+		WHERE user_id = $1 AND provider = $2 AND type = $3 AND search_term = $4
 	`
 
-	result, err := db.Exec(context.Background(), query, userID, subscriptionType, searchTerm)
+	result, err := db.Exec(ctx, query, userID, provider, subscriptionType, searchTerm)
 	if err != nil {
 		return fmt.Errorf("failed to delete subscription: %w", err)
 	}
@@ -2,39 +2,51 @@ package feedsvc
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
-	"kannonfoundry/api-go/api/redgifs"
+	"kannonfoundry/api-go/api"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// StartWorker starts the background worker that periodically fetches new videos
-func StartWorker(db *pgxpool.Pool) {
+// rateLimitBackoff is how long the worker pauses after a 429 that didn't say
+// how long to wait.
+const rateLimitBackoff = 30 * time.Second
+
+// StartWorker starts the background worker that periodically fetches new videos.
+// It returns when ctx is cancelled; an in-progress cycle is cancelled with it.
+func StartWorker(ctx context.Context, db *pgxpool.Pool) {
+	// Upstream rate limiters serve page loads before the worker.
+	ctx = api.WithBackground(ctx)
+
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
 	log.Println("Feed worker started, will run every 10 minutes")
 
 	// Run immediately on startup
-	runWorkerCycle(db)
+	runWorkerCycle(ctx, db)
 
 	// Then run on ticker
-	for range ticker.C {
-		runWorkerCycle(db)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Feed worker stopped")
+			return
+		case <-ticker.C:
+			runWorkerCycle(ctx, db)
+		}
 	}
 }
 
 // runWorkerCycle executes one complete worker cycle
-func runWorkerCycle(db *pgxpool.Pool) {
+func runWorkerCycle(ctx context.Context, db *pgxpool.Pool) {
 	log.Println("Starting feed worker cycle...")
 
-	// Create Redgifs client
-	rgClient := redgifs.NewClient()
-
 	// Get all subscriptions
-	subscriptions, err := GetAllSubscriptions(db)
+	subscriptions, err := GetAllSubscriptions(ctx, db)
 	if err != nil {
 		log.Printf("ERROR: Failed to get subscriptions: %v", err)
 		return
@@ -45,30 +57,69 @@ func runWorkerCycle(db *pgxpool.Pool) {
 	// Process each subscription
 	successCount := 0
 	errorCount := 0
+	rateLimitedCount := 0
+	skippedCount := 0
+	// Providers whose circuit breaker is open are skipped for the rest of
+	// the cycle rather than failing once per subscription.
+	unavailable := map[string]bool{}
 	for _, sub := range subscriptions {
-		err := FetchAndStore(db, &sub, rgClient)
-		if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("Worker cycle cancelled: %v", ctx.Err())
+			return
+		}
+		if unavailable[sub.Provider] {
+			skippedCount++
+			continue
+		}
+		err := FetchAndStore(ctx, db, &sub)
+		var rateLimited *api.RateLimitError
+		switch {
+		case err == nil:
+			successCount++
+		case errors.As(err, &rateLimited):
+			// Back off before touching the next subscription rather than
+			// burning through the rest of the cycle on more 429s.
+			rateLimitedCount++
+			wait := rateLimited.RetryAfter
+			if wait <= 0 {
+				wait = rateLimitBackoff
+			}
+			log.Printf("Rate limited on subscription %s (%s: %s), backing off for %s",
+				sub.Id, sub.Provider+"/"+sub.Type, sub.SearchTerm, wait)
+			select {
+			case <-ctx.Done():
+				log.Printf("Worker cycle cancelled: %v", ctx.Err())
+				return
+			case <-time.After(wait):
+			}
+		case errors.Is(err, api.ErrSourceUnavailable):
+			log.Printf("WARN: %s is unavailable, skipping its subscriptions this cycle: %v", sub.Provider, err)
+			unavailable[sub.Provider] = true
+			skippedCount++
+		case errors.Is(err, api.ErrNotFound):
+			log.Printf("WARN: Subscription %s (%s: %s) no longer exists upstream",
+				sub.Id, sub.Provider+"/"+sub.Type, sub.SearchTerm)
+			errorCount++
+		default:
 			log.Printf("ERROR: Failed to fetch and store for subscription %s (%s: %s): %v",
-				sub.Id, sub.Type, sub.SearchTerm, err)
+				sub.Id, sub.Provider+"/"+sub.Type, sub.SearchTerm, err)
 			errorCount++
-		} else {
-			successCount++
 		}
 	}
 
-	log.Printf("Worker cycle completed: %d succeeded, %d failed", successCount, errorCount)
+	log.Printf("Worker cycle completed: %d succeeded, %d failed, %d rate limited, %d skipped", successCount, errorCount, rateLimitedCount, skippedCount)
 
 	// Run retention cleanup for all users
-	if err := runRetentionCleanup(db); err != nil {
+	if err := runRetentionCleanup(ctx, db); err != nil {
 		log.Printf("ERROR: Failed to run retention cleanup: %v", err)
 	}
 }
 
 // runRetentionCleanup removes old feed items while maintaining minimum 50 items per user
-func runRetentionCleanup(db *pgxpool.Pool) error {
+func runRetentionCleanup(ctx context.Context, db *pgxpool.Pool) error {
 	// Get all unique user IDs
 	userQuery := `SELECT DISTINCT user_id FROM feed_subscriptions`
-	rows, err := db.Query(context.Background(), userQuery)
+	rows, err := db.Query(ctx, userQuery)
 	if err != nil {
 		return err
 	}
@@ -98,7 +149,7 @@ func runRetentionCleanup(db *pgxpool.Pool) error {
 
 	totalDeleted := 0
 	for _, userId := range userIds {
-		result, err := db.Exec(context.Background(), deleteQuery, userId)
+		result, err := db.Exec(ctx, deleteQuery, userId)
 		if err != nil {
 			log.Printf("ERROR: Failed to cleanup for user %s: %v", userId, err)
 			continue
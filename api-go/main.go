@@ -1,20 +1,40 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/api/booru"
+	"kannonfoundry/api-go/api/breaker"
+	"kannonfoundry/api-go/api/cache"
+	"kannonfoundry/api-go/api/coalesce"
+	"kannonfoundry/api-go/api/library"
+	"kannonfoundry/api-go/api/ratelimit"
+	"kannonfoundry/api-go/api/redgifs"
+	"kannonfoundry/api-go/api/rule34"
 	"kannonfoundry/api-go/auth"
 	"kannonfoundry/api-go/components/layout"
 	"kannonfoundry/api-go/db"
 	"kannonfoundry/api-go/feedsvc"
+	"kannonfoundry/api-go/mediacache"
+	"kannonfoundry/api-go/routes/admin"
 	"kannonfoundry/api-go/routes/creators"
+	"kannonfoundry/api-go/routes/feed"
+	"kannonfoundry/api-go/routes/folders"
 	"kannonfoundry/api-go/routes/login"
 	"kannonfoundry/api-go/routes/logout"
 	"kannonfoundry/api-go/routes/register"
-	"kannonfoundry/api-go/routes/feed"
 	"kannonfoundry/api-go/routes/rgp"
 	"kannonfoundry/api-go/routes/search"
+	"kannonfoundry/api-go/routes/settings"
+	"kannonfoundry/api-go/routes/tags"
+	"kannonfoundry/api-go/routes/videos"
+	"kannonfoundry/api-go/timeouts"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,6 +42,36 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// remote wraps a provider that calls an upstream API: responses are cached
+// in memory, identical concurrent calls share one request, the requests
+// that remain fail fast while the provider is down and are rate limited.
+func remote(provider api.MediaSearcher) api.MediaSearcher {
+	limited := ratelimit.Wrap(provider, ratelimit.DefaultBudgets)
+	guarded := breaker.Wrap(limited, breaker.DefaultSettings)
+	return cache.Wrap(coalesce.Wrap(guarded), cache.DefaultPolicy)
+}
+
+// openMediaCache opens the /rgp disk cache in MEDIA_CACHE_DIR, capped at
+// MEDIA_CACHE_MAX_MB. A limit of 0 disables it and returns nil.
+func openMediaCache() (*mediacache.Cache, error) {
+	dir := os.Getenv("MEDIA_CACHE_DIR")
+	if dir == "" {
+		dir = mediacache.DefaultDir
+	}
+	maxBytes := int64(mediacache.DefaultMaxBytes)
+	if mb := os.Getenv("MEDIA_CACHE_MAX_MB"); mb != "" {
+		n, err := strconv.ParseInt(mb, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid MEDIA_CACHE_MAX_MB %q", mb)
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		maxBytes = n << 20
+	}
+	return mediacache.New(dir, maxBytes)
+}
+
 func main() {
 	err := godotenv.Load(".env", ".key.env")
 	if err != nil {
@@ -35,53 +85,105 @@ func main() {
 	}
 	defer dbPool.Close()
 
+	// Register media providers for search and subscriptions
+	api.Register(remote(redgifs.NewProvider()))
+	api.Register(remote(rule34.NewProvider()))
+	booruInstances, err := booru.ParseConfig(os.Getenv("BOORU_INSTANCES"))
+	if err != nil {
+		log.Printf("Skipping Booru instances: %v", err)
+	}
+	for _, instance := range booruInstances {
+		if _, exists := api.Get(instance.Name); exists {
+			log.Printf("Skipping Booru instance %q: provider name already registered", instance.Name)
+			continue
+		}
+		api.Register(remote(booru.NewProvider(instance)))
+	}
+
+	// Local media library, served at /files/ and indexed in the database
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		libraryDir = library.DefaultDir
+	}
+	mediaLibrary := library.New(dbPool, libraryDir)
+	libraryProvider := library.NewProvider(mediaLibrary)
+	api.Register(libraryProvider)
+	folders.SetLibrary(libraryProvider)
+	go mediaLibrary.StartScanner(context.Background())
+
+	// Disk cache for media proxied through /rgp/
+	if cache, err := openMediaCache(); err != nil {
+		log.Printf("Media cache disabled: %v", err)
+	} else if cache != nil {
+		rgp.SetCache(cache)
+		rgp.SetPrefetch(rgp.DefaultPrefetch)
+		admin.SetMediaCache(cache)
+	}
+
 	// Set database for routes that need it
 	login.SetDB(dbPool)
 	register.SetDB(dbPool)
 	creators.SetDB(dbPool)
 	feed.SetDB(dbPool)
+	search.SetDB(dbPool)
+	folders.SetDB(dbPool)
+	settings.SetDB(dbPool)
 
 	// Start background worker for feed updates
-	go feedsvc.StartWorker(dbPool)
+	go feedsvc.StartWorker(context.Background(), dbPool)
 
 	r := mux.NewRouter()
 	log.Println("Server started on :8080")
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	// Media streams run for as long as they keep moving; everything else
+	// gets a strict deadline.
+	stream := timeouts.Stream(timeouts.DefaultStream)
+	r.PathPrefix("/rgp/").Handler(stream(http.StripPrefix("/rgp/", http.HandlerFunc(rgp.Serve))))
+	r.PathPrefix("/files/").Handler(stream(http.StripPrefix("/files/", http.FileServer(http.Dir(libraryDir)))))
+	pages := r.NewRoute().Subrouter()
+	pages.Use(timeouts.Strict(15 * time.Second))
+	pages.HandleFunc("/admin/upstream", admin.Upstream).Methods("GET")
+	pages.HandleFunc("/admin/media-cache", admin.MediaCache).Methods("GET")
+	pages.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
-	r.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+	pages.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
 		guid := uuid.New().String()
-		os.Create("files/" + guid)
+		os.Create(filepath.Join(libraryDir, guid))
 
 		w.WriteHeader(http.StatusOK)
 		w.Header().Add("Location", "/files/"+guid)
 		w.Write([]byte("Done"))
 	})
-	r.PathPrefix("/rgp/").Handler(http.StripPrefix("/rgp/", http.HandlerFunc(rgp.Serve)))
-	r.HandleFunc("/search", search.Serve)
-	r.PathPrefix("/files/").Handler(http.StripPrefix("/files/", http.FileServer(http.Dir("files"))))
-	r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
-	r.HandleFunc("/feed", feed.Serve)
-	r.HandleFunc("/creators/{username}/subscribe", creators.Subscribe).Methods("POST")
-	r.HandleFunc("/creators/{username}/subscribe", creators.Unsubscribe).Methods("DELETE")
-	r.HandleFunc("/creators/{username}/subscription-status", creators.SubscriptionStatus).Methods("GET")
+	pages.HandleFunc("/search/subscribe", search.Subscribe).Methods("POST")
+	pages.HandleFunc("/search/filters", search.Filters).Methods("GET")
+	pages.HandleFunc("/search", search.Serve)
+	pages.HandleFunc("/tags/suggest", tags.Suggest).Methods("GET")
+	pages.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
+	pages.HandleFunc("/feed", feed.Serve)
+	pages.HandleFunc("/folders/subscribe", folders.Subscribe).Methods("POST")
+	pages.HandleFunc("/folders/subscribe", folders.Unsubscribe).Methods("DELETE")
+	pages.HandleFunc("/folders", folders.Serve)
+	pages.HandleFunc("/creators/{username}/subscribe", creators.Subscribe).Methods("POST")
+	pages.HandleFunc("/creators/{username}/subscribe", creators.Unsubscribe).Methods("DELETE")
+	pages.HandleFunc("/creators/{username}/subscription-status", creators.SubscriptionStatus).Methods("GET")
 	srv := &http.Server{
 		Handler: r,
 		Addr:    ":8080",
-		// Good practice: enforce timeouts for servers you create!
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		// Write deadlines are set per route by the timeouts middleware.
+		ReadTimeout: 15 * time.Second,
 	}
-	r.HandleFunc("/creators/{username}", creators.Serve)
-	r.HandleFunc("/login", login.LoginPost).Methods("POST")
-	r.HandleFunc("/login", login.Serve).Methods("GET")
-	r.HandleFunc("/register", register.RegisterPost).Methods("POST")
-	r.HandleFunc("/register", register.Serve).Methods("GET")
-	r.HandleFunc("/logout", logout.Serve)
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	pages.HandleFunc("/creators/{username}", creators.Serve)
+	pages.HandleFunc("/videos/{id}", videos.Serve).Methods("GET")
+	pages.HandleFunc("/login", login.LoginPost).Methods("POST")
+	pages.HandleFunc("/login", login.Serve).Methods("GET")
+	pages.HandleFunc("/register", register.RegisterPost).Methods("POST")
+	pages.HandleFunc("/register", register.Serve).Methods("GET")
+	pages.HandleFunc("/logout", logout.Serve)
+	pages.HandleFunc("/settings/safe-mode", settings.SafeMode).Methods("POST")
+	pages.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		user := auth.IsLoggedIn(r)
-		layout.Root("Kannonfoundry", layout.Search(user)).Render(r.Context(), w)
+		layout.Root("Kannonfoundry", layout.Search(user, r.URL.Query().Get("search"))).Render(r.Context(), w)
 	})
 	log.Fatal(srv.ListenAndServe())
 }
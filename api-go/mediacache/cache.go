@@ -0,0 +1,282 @@
+// Package mediacache keeps proxied media files on disk so repeat plays don't
+// download them again. Files are evicted least recently used first once the
+// cache outgrows its size limit.
+package mediacache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDir is where the cache lives unless MEDIA_CACHE_DIR says
+	// otherwise.
+	DefaultDir = "cache/media"
+	// DefaultMaxBytes is the cache's size limit unless MEDIA_CACHE_MAX_MB
+	// says otherwise.
+	DefaultMaxBytes = 1 << 30
+)
+
+// Meta describes a cached file. The caching headers are kept so responses
+// served from disk carry the same validators as the original.
+type Meta struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Stored       time.Time `json:"stored"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	CacheControl string    `json:"cache_control,omitempty"`
+}
+
+// Cache is a directory of media files keyed by upstream URL. It is safe for
+// concurrent use.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	order   *list.List // of *entry, front is most recently used
+	entries map[string]*list.Element
+	writing map[string]bool
+	bytes   int64
+	stats   Stats
+}
+
+type entry struct {
+	key  string
+	meta Meta
+}
+
+// New opens the cache in dir, creating it if needed, and indexes the files
+// already there so the cache survives restarts.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+		writing:  map[string]bool{},
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load indexes the cached files, most recently used (newest mtime) first,
+// and clears out partial writes and data files without metadata left by a
+// crash.
+func (c *Cache) load() error {
+	os.RemoveAll(filepath.Join(c.dir, "tmp"))
+	if err := os.MkdirAll(filepath.Join(c.dir, "tmp"), 0o755); err != nil {
+		return fmt.Errorf("failed to create media cache: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*", "*"))
+	if err != nil {
+		return fmt.Errorf("failed to list media cache: %w", err)
+	}
+	var metas []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".json") {
+			metas = append(metas, path)
+		} else if _, err := os.Stat(path + ".json"); errors.Is(err, fs.ErrNotExist) {
+			os.Remove(path)
+		}
+	}
+	type found struct {
+		entry
+		used time.Time
+	}
+	var files []found
+	for _, metaFile := range metas {
+		key := strings.TrimSuffix(filepath.Base(metaFile), ".json")
+		data, err := os.ReadFile(metaFile)
+		var meta Meta
+		if err == nil {
+			err = json.Unmarshal(data, &meta)
+		}
+		info, statErr := os.Stat(c.path(key))
+		if err != nil || statErr != nil || info.Size() != meta.Size {
+			c.removeFiles(key)
+			continue
+		}
+		files = append(files, found{entry{key, meta}, info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b found) int {
+		return b.used.Compare(a.used)
+	})
+	for _, f := range files {
+		c.entries[f.key] = c.order.PushBack(&f.entry)
+		c.bytes += f.meta.Size
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	return nil
+}
+
+// Key returns the cache key for an upstream URL.
+func Key(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns where key's data is stored. Files are spread over 256
+// subdirectories to keep directories small.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *Cache) metaPath(key string) string {
+	return c.path(key) + ".json"
+}
+
+func (c *Cache) removeFiles(key string) {
+	os.Remove(c.path(key))
+	os.Remove(c.metaPath(key))
+}
+
+// Open returns key's cached file, counting a hit, or reports a miss. The
+// caller must close the file.
+func (c *Cache) Open(key string) (*os.File, Meta, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, Meta{}, false
+	}
+	c.order.MoveToFront(el)
+	meta := el.Value.(*entry).meta
+	c.mu.Unlock()
+
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		log.Printf("WARN: Dropping unreadable media cache entry %s: %v", meta.URL, err)
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, Meta{}, false
+	}
+	// The mtime records use, so recency survives restarts.
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+
+	c.mu.Lock()
+	c.stats.Hits++
+	c.mu.Unlock()
+	return f, meta, true
+}
+
+// Contains reports whether key is cached, without counting a hit or miss or
+// marking it used.
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Create starts caching meta.URL under key. It returns nil when the file is
+// too big to cache or is already being written, in which case the response
+// is streamed without caching.
+func (c *Cache) Create(key string, meta Meta) *Writer {
+	// One file may not push out more than a quarter of the cache.
+	if meta.Size <= 0 || meta.Size > c.maxBytes/4 {
+		return nil
+	}
+	c.mu.Lock()
+	if c.writing[key] {
+		c.mu.Unlock()
+		return nil
+	}
+	c.writing[key] = true
+	c.mu.Unlock()
+
+	f, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), key+"-*")
+	if err != nil {
+		log.Printf("WARN: Not caching %s: %v", meta.URL, err)
+		c.doneWriting(key)
+		return nil
+	}
+	return &Writer{cache: c, key: key, meta: meta, file: f}
+}
+
+func (c *Cache) doneWriting(key string) {
+	c.mu.Lock()
+	delete(c.writing, key)
+	c.mu.Unlock()
+}
+
+// add indexes a committed file and evicts what no longer fits.
+func (c *Cache) add(key string, meta Meta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.bytes -= el.Value.(*entry).meta.Size
+		el.Value = &entry{key: key, meta: meta}
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[key] = c.order.PushFront(&entry{key: key, meta: meta})
+	}
+	c.bytes += meta.Size
+	c.stats.Stored++
+	c.evict()
+}
+
+// evict removes least recently used files until the cache fits. Callers
+// must hold c.mu.
+func (c *Cache) evict() {
+	for c.bytes > c.maxBytes && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+		c.stats.Evicted++
+	}
+}
+
+// remove drops el and its files. Callers must hold c.mu. Files being
+// served stay readable until closed.
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.bytes -= e.meta.Size
+	c.removeFiles(e.key)
+}
+
+// Stats is a snapshot of the cache's size and counters.
+type Stats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Stored   int64 `json:"stored"`
+	Evicted  int64 `json:"evicted"`
+}
+
+// Stats returns the cache's size and counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.Bytes = c.bytes
+	stats.MaxBytes = c.maxBytes
+	return stats
+}
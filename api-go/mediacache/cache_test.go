@@ -0,0 +1,209 @@
+package mediacache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCache(t *testing.T, dir string, maxBytes int64) *Cache {
+	t.Helper()
+	c, err := New(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// put caches data for url and returns its key.
+func put(t *testing.T, c *Cache, url, data string) string {
+	t.Helper()
+	key := Key(url)
+	w := c.Create(key, Meta{URL: url, ContentType: "video/mp4", Size: int64(len(data))})
+	if w == nil {
+		t.Fatalf("Create(%s) refused", url)
+	}
+	io.WriteString(w, data)
+	w.Commit()
+	if !c.Contains(key) {
+		t.Fatalf("%s wasn't stored", url)
+	}
+	return key
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestStoreAndOpen(t *testing.T) {
+	c := newCache(t, t.TempDir(), 1000)
+	key := put(t, c, "https://media/a.mp4", "0123456789")
+
+	f, meta, ok := c.Open(key)
+	if !ok {
+		t.Fatal("cached file missing")
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "0123456789" || meta.URL != "https://media/a.mp4" || meta.ContentType != "video/mp4" || meta.Stored.IsZero() {
+		t.Errorf("got %q, %+v", data, meta)
+	}
+	if _, _, ok := c.Open(Key("https://media/b.mp4")); ok {
+		t.Error("opened a file that was never cached")
+	}
+	want := Stats{Entries: 1, Bytes: 10, MaxBytes: 1000, Hits: 1, Misses: 1, Stored: 1}
+	if s := c.Stats(); s != want {
+		t.Errorf("stats %+v, want %+v", s, want)
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCache(t, t.TempDir(), 40)
+	a := put(t, c, "a", "aaaaaaaaaa")
+	b := put(t, c, "b", "bbbbbbbbbb")
+	put(t, c, "c", "cccccccccc")
+	put(t, c, "d", "dddddddddd")
+	// Using a makes b the least recently used.
+	f, _, _ := c.Open(a)
+	f.Close()
+	put(t, c, "e", "eeeeeeeeee")
+
+	if c.Contains(b) || exists(c.path(b)) || exists(c.metaPath(b)) {
+		t.Error("b wasn't evicted")
+	}
+	if !c.Contains(a) {
+		t.Error("a was evicted although it was just used")
+	}
+	if s := c.Stats(); s.Entries != 4 || s.Bytes != 40 || s.Evicted != 1 {
+		t.Errorf("stats %+v, want 4 entries, 40 bytes, 1 evicted", s)
+	}
+}
+
+func TestCreateRefuses(t *testing.T) {
+	c := newCache(t, t.TempDir(), 40)
+	if c.Create(Key("empty"), Meta{URL: "empty"}) != nil {
+		t.Error("cached a file of unknown size")
+	}
+	// One file may not take more than a quarter of the cache.
+	if c.Create(Key("big"), Meta{URL: "big", Size: 11}) != nil {
+		t.Error("cached a file over a quarter of the cache")
+	}
+
+	key := Key("a")
+	w := c.Create(key, Meta{URL: "a", Size: 10})
+	if w == nil {
+		t.Fatal("Create refused a file that fits")
+	}
+	if c.Create(key, Meta{URL: "a", Size: 10}) != nil {
+		t.Error("two writers for the same file")
+	}
+	w.Abort()
+	w = c.Create(key, Meta{URL: "a", Size: 10})
+	if w == nil {
+		t.Fatal("Create refused a file after the previous writer aborted")
+	}
+	w.Abort()
+	if c.Contains(key) {
+		t.Error("aborted file was cached")
+	}
+}
+
+func TestCommitIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, dir, 1000)
+	key := Key("a")
+	w := c.Create(key, Meta{URL: "a", Size: 10})
+	io.WriteString(w, "01234")
+	w.Commit()
+
+	if c.Contains(key) || exists(c.path(key)) || exists(c.metaPath(key)) {
+		t.Error("a partial body was cached")
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("left %d temporary files", len(tmp))
+	}
+	if c.Create(key, Meta{URL: "a", Size: 10}) == nil {
+		t.Error("Create refused a file after a failed commit")
+	}
+}
+
+func TestReloadKeepsRecency(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, dir, 100)
+	a := put(t, c, "a", "aaaaaaaaaa")
+	b := put(t, c, "b", "bbbbbbbbbb")
+	cc := put(t, c, "c", "cccccccccc")
+	// Modification times record use: b is the oldest.
+	now := time.Now()
+	os.Chtimes(c.path(a), now, now)
+	os.Chtimes(c.path(b), now, now.Add(-2*time.Hour))
+	os.Chtimes(c.path(cc), now, now.Add(-time.Hour))
+
+	c = newCache(t, dir, 20)
+	if c.Contains(b) || !c.Contains(a) || !c.Contains(cc) {
+		t.Errorf("after reloading into a smaller cache: a %v, b %v, c %v; want b evicted",
+			c.Contains(a), c.Contains(b), c.Contains(cc))
+	}
+	f, meta, ok := c.Open(a)
+	if !ok {
+		t.Fatal("a missing after reload")
+	}
+	f.Close()
+	if meta.URL != "a" || meta.Size != 10 {
+		t.Errorf("reloaded meta %+v", meta)
+	}
+}
+
+func TestLoadCleansUp(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, dir, 100)
+	good := put(t, c, "good", "0123456789")
+
+	write := func(path, content string) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A crash mid-write leaves a temporary file.
+	tmp := filepath.Join(dir, "tmp", Key("partial")+"-1")
+	write(tmp, "01234")
+	// A crash before store wrote metadata leaves data alone.
+	orphan := Key("orphan")
+	write(c.path(orphan), "0123456789")
+	// A crash between writing metadata and renaming the data leaves
+	// metadata alone.
+	noData := Key("no data")
+	write(c.metaPath(noData), `{"url":"no data","size":10}`)
+	// Files that don't match their metadata, or metadata that doesn't parse.
+	wrongSize := Key("wrong size")
+	write(c.path(wrongSize), "01234")
+	write(c.metaPath(wrongSize), `{"url":"wrong size","size":10}`)
+	corrupt := Key("corrupt")
+	write(c.path(corrupt), "0123456789")
+	write(c.metaPath(corrupt), `{"url":`)
+
+	c = newCache(t, dir, 100)
+	if !c.Contains(good) {
+		t.Error("intact file dropped")
+	}
+	if s := c.Stats(); s.Entries != 1 || s.Bytes != 10 {
+		t.Errorf("stats %+v, want only the intact file", s)
+	}
+	for _, path := range []string{
+		tmp,
+		c.path(orphan),
+		c.metaPath(noData),
+		c.path(wrongSize), c.metaPath(wrongSize),
+		c.path(corrupt), c.metaPath(corrupt),
+	} {
+		if exists(path) {
+			t.Errorf("%s left behind", strings.TrimPrefix(path, dir))
+		}
+	}
+}
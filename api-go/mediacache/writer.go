@@ -0,0 +1,82 @@
+package mediacache
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writer fills a cache file while the response it copies is streamed. Write
+// errors don't fail the response: the file is just not committed.
+type Writer struct {
+	cache   *Cache
+	key     string
+	meta    Meta
+	file    *os.File
+	written int64
+	err     error
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err == nil {
+		var n int
+		n, w.err = w.file.Write(p)
+		w.written += int64(n)
+	}
+	return len(p), nil
+}
+
+// Commit adds the file to the cache if the whole body was written, and
+// discards it otherwise.
+func (w *Writer) Commit() {
+	defer w.cache.doneWriting(w.key)
+	tmp := w.file.Name()
+	err := w.err
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && w.written != w.meta.Size {
+		err = fmt.Errorf("got %d of %d bytes", w.written, w.meta.Size)
+	}
+	if err == nil {
+		err = w.store(tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("WARN: Not caching %s: %v", w.meta.URL, err)
+		return
+	}
+	w.cache.add(w.key, w.meta)
+}
+
+// Abort discards the file, e.g. when the browser went away mid-stream.
+func (w *Writer) Abort() {
+	defer w.cache.doneWriting(w.key)
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func (w *Writer) store(tmp string) error {
+	w.meta.Stored = time.Now()
+	meta, err := json.Marshal(w.meta)
+	if err != nil {
+		return err
+	}
+	path := w.cache.path(w.key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// The data goes in last: a crash in between leaves metadata without
+	// data, which load discards, rather than data it can't account for.
+	if err := os.WriteFile(w.cache.metaPath(w.key), meta, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(w.cache.metaPath(w.key))
+		return err
+	}
+	return nil
+}
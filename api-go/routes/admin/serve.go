@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/mediacache"
+)
+
+var mediaCache *mediacache.Cache
+
+// SetMediaCache sets the /rgp disk cache MediaCache reports on.
+func SetMediaCache(cache *mediacache.Cache) {
+	mediaCache = cache
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// requireAdmin answers 403 unless the request comes from an operator.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !auth.IsAdmin(auth.IsLoggedIn(r)) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return false
+	}
+	return true
+}
+
+// Upstream serves the counters of every registered provider's wrappers as
+// JSON, keyed by provider name.
+func Upstream(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	stats := map[string]map[string]any{}
+	for _, provider := range api.Providers() {
+		stats[provider.Name()] = api.ProviderStats(provider)
+	}
+	writeJSON(w, stats)
+}
+
+// MediaCache serves the /rgp disk cache's size and hit/miss counters as
+// JSON.
+func MediaCache(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if mediaCache == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Media cache is disabled"))
+		return
+	}
+	writeJSON(w, mediaCache.Stats())
+}
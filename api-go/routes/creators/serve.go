@@ -1,6 +1,9 @@
 package creators
 
 import (
+	"errors"
+	"fmt"
+	"kannonfoundry/api-go/api"
 	"kannonfoundry/api-go/api/redgifs"
 	"kannonfoundry/api-go/auth"
 	"kannonfoundry/api-go/components"
@@ -16,6 +19,32 @@ import (
 func render(w http.ResponseWriter, r *http.Request, template templ.Component, username string) {
 	layout.Root(username, template).Render(r.Context(), w)
 }
+
+// writeUpstreamError answers with the status matching a provider error,
+// passing on how long to wait when we've been rate limited or the provider
+// is down. When source's circuit breaker is open the page says so.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, source, msg string, err error) {
+	if retryAfter := api.RetryAfter(err); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	w.WriteHeader(api.HTTPStatus(err))
+	if errors.Is(err, api.ErrSourceUnavailable) {
+		render(w, r, layout.SourceUnavailable(source, err), source)
+		return
+	}
+	w.Write([]byte(msg + err.Error()))
+}
+
+// provider returns the provider named by ?provider=, defaulting to Redgifs.
+func provider(r *http.Request) (api.MediaSearcher, error) {
+	name := r.URL.Query().Get("provider")
+	p, ok := api.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", api.ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
 	//This is where we need to get the username and render the creator page
 	username := mux.Vars(r)["username"]
@@ -24,40 +53,51 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		page = 1
 	}
 
-	redgifsapiClient := redgifs.NewClient()
-	creator, err := redgifsapiClient.GetCreator(username)
+	p, err := provider(r)
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Error fetching creator: " + err.Error()))
+		writeUpstreamError(w, r, r.URL.Query().Get("provider"), "Error fetching creator: ", err)
+		return
+	}
+	creator, err := p.GetCreator(r.Context(), username)
+	if errors.Is(err, api.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		render(w, r, layout.CreatorNotFound(username), username)
 		return
 	}
+	if err != nil {
+		writeUpstreamError(w, r, p.DisplayName(), "Error fetching creator: ", err)
+		return
+	}
+	safeMode := auth.SafeMode(r)
 	// Proxy the profile image URL to avoid external 403s
-	creator.ProfileImageUrl = redgifs.ProxyURL(creator.ProfileImageUrl)
-	files, err := redgifsapiClient.SearchByUser(username, 20, page)
+	creator.ProfileImageURL = redgifs.ProxyURL(creator.ProfileImageURL, safeMode)
+	result, err := p.CreatorItems(r.Context(), username, 20, api.PageCursor(page))
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Error during search: " + err.Error()))
+		writeUpstreamError(w, r, p.DisplayName(), "Error during search: ", err)
 		return
 	}
+	files := result.Files
 
 	// Auth + subscription state
 	user := auth.IsLoggedIn(r)
 	isLoggedIn := !user.IsEmpty()
 	isSubscribed := false
 	if isLoggedIn && dbPool != nil {
-		if sub, err := feedsvc.GetSubscriptionByUserAndTerm(dbPool, user.Id, "creator", username); err == nil && sub != nil {
+		if sub, err := feedsvc.GetSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, p.Name(), "creator", username); err == nil && sub != nil {
 			isSubscribed = true
 		}
 	}
 
-	redgifs.FormatFileUrls(files)
+	redgifs.FormatFileUrls(files, safeMode)
+	if safeMode {
+		api.UsePlaceholders(files)
+	}
+	more := components.More(components.CreatorURL(p.Name(), username), page, "")
 	if page == 1 {
 		render(w, r,
-			layout.Creator(*creator, components.Video(files,
-				components.More("/creators/"+username, page, "")), isLoggedIn, isSubscribed), username)
+			layout.Creator(p.Name(), *creator, components.Video(files, safeMode, more), isLoggedIn, isSubscribed), username)
 	} else {
-		components.Video(files,
-			components.More("/creators/"+username, page, "")).Render(r.Context(), w)
+		components.Video(files, safeMode, more).Render(r.Context(), w)
 	}
 
 }
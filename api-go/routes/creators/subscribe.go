@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/components"
 	"kannonfoundry/api-go/feedsvc"
 
 	"github.com/gorilla/mux"
@@ -18,14 +19,14 @@ func ensureDBReady(w http.ResponseWriter) bool {
 	return true
 }
 
-func writeSubscribed(w http.ResponseWriter, username string) {
+func writeSubscribed(w http.ResponseWriter, r *http.Request, provider, username string) {
 	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte("<button id=\"subscribe-btn\" class=\"btn subscribed\" hx-delete=\"/creators/" + username + "/subscribe\" hx-target=\"#subscribe-btn\" hx-swap=\"outerHTML\">Subscribed ✓</button>"))
+	components.SubscribeButton(provider, username, true).Render(r.Context(), w)
 }
 
-func writeUnsubscribed(w http.ResponseWriter, username string) {
+func writeUnsubscribed(w http.ResponseWriter, r *http.Request, provider, username string) {
 	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte("<button id=\"subscribe-btn\" class=\"btn\" hx-post=\"/creators/" + username + "/subscribe\" hx-target=\"#subscribe-btn\" hx-swap=\"outerHTML\">Subscribe</button>"))
+	components.SubscribeButton(provider, username, false).Render(r.Context(), w)
 }
 
 // Subscribe creates a creator subscription for the logged-in user.
@@ -46,27 +47,33 @@ func Subscribe(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("missing username"))
 		return
 	}
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 
 	// Check if already subscribed; idempotent.
-	sub, err := feedsvc.GetSubscriptionByUserAndTerm(dbPool, user.Id, "creator", username)
+	sub, err := feedsvc.GetSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, p.Name(), "creator", username)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
 		return
 	}
 	if sub != nil {
-		writeSubscribed(w, username)
+		writeSubscribed(w, r, p.Name(), username)
 		return
 	}
 
-	_, err = feedsvc.CreateSubscription(dbPool, user.Id, "creator", username)
+	_, err = feedsvc.CreateSubscription(r.Context(), dbPool, user.Id, p.Name(), "creator", username)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	writeSubscribed(w, username)
+	writeSubscribed(w, r, p.Name(), username)
 }
 
 // Unsubscribe removes a creator subscription for the logged-in user.
@@ -87,16 +94,22 @@ func Unsubscribe(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("missing username"))
 		return
 	}
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 
-	err := feedsvc.DeleteSubscriptionByUserAndTerm(dbPool, user.Id, "creator", username)
+	err = feedsvc.DeleteSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, p.Name(), "creator", username)
 	if err != nil {
 		// If not found, still return unsubscribed state for idempotency
 		w.WriteHeader(http.StatusOK)
-		writeUnsubscribed(w, username)
+		writeUnsubscribed(w, r, p.Name(), username)
 		return
 	}
 
-	writeUnsubscribed(w, username)
+	writeUnsubscribed(w, r, p.Name(), username)
 }
 
 // SubscriptionStatus returns the current button state for HTMX swaps.
@@ -111,6 +124,12 @@ func SubscriptionStatus(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("missing username"))
 		return
 	}
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 
 	if user.IsEmpty() {
 		// Not logged in: show login prompt button
@@ -119,7 +138,7 @@ func SubscriptionStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sub, err := feedsvc.GetSubscriptionByUserAndTerm(dbPool, user.Id, "creator", username)
+	sub, err := feedsvc.GetSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, p.Name(), "creator", username)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
@@ -127,8 +146,8 @@ func SubscriptionStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if sub != nil {
-		writeSubscribed(w, username)
+		writeSubscribed(w, r, p.Name(), username)
 	} else {
-		writeUnsubscribed(w, username)
+		writeUnsubscribed(w, r, p.Name(), username)
 	}
 }
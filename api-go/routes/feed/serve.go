@@ -1,8 +1,11 @@
 package feed
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"kannonfoundry/api-go/api"
 	"kannonfoundry/api-go/api/redgifs"
@@ -10,6 +13,7 @@ import (
 	"kannonfoundry/api-go/components"
 	"kannonfoundry/api-go/components/layout"
 	"kannonfoundry/api-go/feedsvc"
+	"kannonfoundry/api-go/routes/rgp"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -41,7 +45,7 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	const limit = 20
 	offset := (page - 1) * limit
 
-	items, err := feedsvc.GetUserFeed(dbPool, user.Id, limit, offset)
+	items, err := feedsvc.GetUserFeed(r.Context(), dbPool, user.Id, limit, offset)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Error fetching feed: " + err.Error()))
@@ -51,18 +55,41 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	// Map to api.FileToSend and proxy URLs
 	var files []api.FileToSend
 	for _, it := range items {
-		files = append(files, api.FileToSend{
-			Name:     it.VideoId,
-			URL:      redgifs.ProxyURL(it.Url),
-			Username: it.Username,
-		})
+		files = append(files, it.ToFileToSend())
+	}
+	redgifs.FormatFileUrls(files, user.InSafeMode())
+	if user.InSafeMode() {
+		api.UsePlaceholders(files)
 	}
 
-	content := components.Video(files, components.More("/feed", page, ""))
+	content := components.Video(files, user.InSafeMode(), components.More("/feed", page, ""))
 
 	if page == 1 {
 		layout.Root("Feed", layout.Feed(user, content)).Render(r.Context(), w)
 	} else {
 		content.Render(r.Context(), w)
 	}
+
+	// Warm the media cache with the next page while this one is watched.
+	if rgp.Prefetching() && !user.InSafeMode() {
+		go prefetchPage(user.Id, limit, offset+limit)
+	}
+}
+
+// prefetchPage queues the media of the user's feed page at offset for
+// prefetching into the /rgp cache.
+func prefetchPage(userID string, limit, offset int) {
+	ctx, cancel := context.WithTimeout(api.WithBackground(context.Background()), 10*time.Second)
+	defer cancel()
+	items, err := feedsvc.GetUserFeed(ctx, dbPool, userID, limit, offset)
+	if err != nil {
+		log.Printf("WARN: Not prefetching feed for %s: %v", userID, err)
+		return
+	}
+	var urls []string
+	for _, it := range items {
+		file := it.ToFileToSend()
+		urls = append(urls, redgifs.ProxyURL(file.URL, false), redgifs.ProxyURL(file.PosterURL, false))
+	}
+	rgp.Prefetch(userID, urls)
 }
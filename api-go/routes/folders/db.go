@@ -0,0 +1,21 @@
+package folders
+
+import (
+	"kannonfoundry/api-go/api/library"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	dbPool   *pgxpool.Pool
+	provider *library.Provider
+)
+
+func SetDB(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// SetLibrary sets the media library the folder pages browse.
+func SetLibrary(p *library.Provider) {
+	provider = p
+}
@@ -0,0 +1,63 @@
+package folders
+
+import (
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/api/library"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/components"
+	"kannonfoundry/api-go/components/layout"
+	"kannonfoundry/api-go/feedsvc"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Serve renders /folders?path=, a folder of the local media library with its
+// subfolders and a subscribe button. Later pages render just the videos.
+func Serve(w http.ResponseWriter, r *http.Request) {
+	if provider == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("media library not configured"))
+		return
+	}
+	folder := library.CleanFolder(r.URL.Query().Get("path"))
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	result, err := provider.FolderItems(r.Context(), folder, 20, api.PageCursor(page))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Error listing folder: " + err.Error()))
+		return
+	}
+	safeMode := auth.SafeMode(r)
+	if safeMode {
+		api.UsePlaceholders(result.Files)
+	}
+	videos := components.Video(result.Files, safeMode,
+		components.More("/folders?path="+url.QueryEscape(folder), page, ""))
+	if page > 1 {
+		videos.Render(r.Context(), w)
+		return
+	}
+
+	subfolders, err := provider.Subfolders(r.Context(), folder)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Error listing folder: " + err.Error()))
+		return
+	}
+
+	user := auth.IsLoggedIn(r)
+	isLoggedIn := !user.IsEmpty()
+	isSubscribed := false
+	if isLoggedIn && dbPool != nil {
+		if sub, err := feedsvc.GetSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, library.ProviderName, "folder", folder); err == nil && sub != nil {
+			isSubscribed = true
+		}
+	}
+
+	layout.Root("Library", layout.Folder(folder, subfolders, videos, isLoggedIn, isSubscribed)).Render(r.Context(), w)
+}
@@ -0,0 +1,61 @@
+package folders
+
+import (
+	"net/http"
+
+	"kannonfoundry/api-go/api/library"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/components"
+	"kannonfoundry/api-go/feedsvc"
+)
+
+func writeButton(w http.ResponseWriter, r *http.Request, folder string, subscribed bool) {
+	w.Header().Set("Content-Type", "text/html")
+	components.SubscribeFolderButton(folder, subscribed).Render(r.Context(), w)
+}
+
+// Subscribe creates a folder subscription for the logged-in user.
+func Subscribe(w http.ResponseWriter, r *http.Request) {
+	if dbPool == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("database not configured"))
+		return
+	}
+	user := auth.IsLoggedIn(r)
+	if user.IsEmpty() {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Login required"))
+		return
+	}
+
+	folder := library.CleanFolder(r.URL.Query().Get("path"))
+	_, err := feedsvc.CreateSubscription(r.Context(), dbPool, user.Id, library.ProviderName, "folder", folder)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	writeButton(w, r, folder, true)
+}
+
+// Unsubscribe removes a folder subscription for the logged-in user.
+func Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if dbPool == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("database not configured"))
+		return
+	}
+	user := auth.IsLoggedIn(r)
+	if user.IsEmpty() {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Login required"))
+		return
+	}
+
+	folder := library.CleanFolder(r.URL.Query().Get("path"))
+	// Not found still answers with the unsubscribed state, for idempotency.
+	feedsvc.DeleteSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, library.ProviderName, "folder", folder)
+
+	writeButton(w, r, folder, false)
+}
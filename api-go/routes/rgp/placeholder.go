@@ -0,0 +1,33 @@
+package rgp
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// placeholderDir holds what safe mode serves instead of media.
+const placeholderDir = "assets/safe-mode"
+
+// placeholderCacheControl lets browsers keep placeholders for a day; they
+// only change with a deploy.
+const placeholderCacheControl = "public, max-age=86400"
+
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// servePlaceholder answers a safe mode URL with the bundled placeholder
+// image or video, whichever path names. Upstream isn't contacted.
+func servePlaceholder(w http.ResponseWriter, r *http.Request, path string) {
+	name := "placeholder.mp4"
+	if imageExtensions[strings.ToLower(filepath.Ext(path))] {
+		name = "placeholder.svg"
+	}
+	w.Header().Set("Cache-Control", placeholderCacheControl)
+	http.ServeFile(w, r, filepath.Join(placeholderDir, name))
+}
@@ -0,0 +1,218 @@
+package rgp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/mediacache"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrefetchSettings bounds the background downloads that warm the disk cache
+// with media a user is about to reach.
+type PrefetchSettings struct {
+	PerUser    int           // downloads at once for one user
+	Global     int           // downloads at once for everyone
+	MaxPending int           // files one user may have queued; more are dropped
+	Idle       time.Duration // a user's prefetches are cancelled after this long without a request
+}
+
+// DefaultPrefetch keeps prefetching well clear of playback: a couple of
+// files per user, a handful overall, and nothing once the user has been away
+// for two minutes.
+var DefaultPrefetch = PrefetchSettings{
+	PerUser:    2,
+	Global:     6,
+	MaxPending: 40,
+	Idle:       2 * time.Minute,
+}
+
+// prefetcher runs prefetches; nil disables them.
+var prefetcher *prefetch
+
+// SetPrefetch enables prefetching with settings. Files are prefetched into
+// the disk cache, so it does nothing without one (see SetCache).
+func SetPrefetch(settings PrefetchSettings) {
+	prefetcher = &prefetch{
+		settings: settings,
+		global:   make(chan struct{}, settings.Global),
+		users:    map[string]*userPrefetch{},
+		pending:  map[string]bool{},
+	}
+}
+
+// Prefetching reports whether Prefetch will do anything.
+func Prefetching() bool {
+	return prefetcher != nil && mediaCache != nil
+}
+
+type prefetch struct {
+	settings PrefetchSettings
+	global   chan struct{}
+
+	mu      sync.Mutex
+	users   map[string]*userPrefetch
+	pending map[string]bool // cache keys queued or downloading
+}
+
+// userPrefetch is one user's queue. Its context is cancelled when the idle
+// timer fires.
+type userPrefetch struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	idle    *time.Timer
+	slots   chan struct{}
+	pending int
+}
+
+// Prefetch downloads the files behind urls, /rgp/ URLs from
+// redgifs.ProxyURL, into the disk cache on behalf of userID, so they play
+// from disk once the user gets to them. Other URLs, safe mode URLs and files
+// already cached are skipped. It returns at once.
+func Prefetch(userID string, urls []string) {
+	p := prefetcher
+	if !Prefetching() || userID == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.user(userID)
+	for _, raw := range urls {
+		if u.pending >= p.settings.MaxPending {
+			break
+		}
+		target, immutable, ok := prefetchTarget(raw)
+		if !ok {
+			continue
+		}
+		key := mediacache.Key(target)
+		if p.pending[key] || mediaCache.Contains(key) {
+			continue
+		}
+		p.pending[key] = true
+		u.pending++
+		go p.run(u, target, immutable, key)
+	}
+}
+
+// prefetchTarget returns the upstream URL behind a proxy URL worth
+// prefetching.
+func prefetchTarget(raw string) (target string, immutable bool, ok bool) {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasPrefix(u.Path, "/rgp/") || u.Query().Get("sfw") != "" {
+		return "", false, false
+	}
+	u.Path = strings.TrimPrefix(u.Path, "/rgp")
+	target, err = upstreamURL(u)
+	if err != nil {
+		return "", false, false
+	}
+	return target, immutableHosts[u.Query().Get("h")], true
+}
+
+// user returns userID's queue, restarting its idle timer, or a new one if
+// it has none or it has just gone idle. Callers must hold p.mu.
+func (p *prefetch) user(userID string) *userPrefetch {
+	if u, ok := p.users[userID]; ok && u.idle.Stop() {
+		u.idle.Reset(p.settings.Idle)
+		return u
+	}
+	ctx, cancel := context.WithCancel(api.WithBackground(context.Background()))
+	u := &userPrefetch{ctx: ctx, cancel: cancel, slots: make(chan struct{}, p.settings.PerUser)}
+	u.idle = time.AfterFunc(p.settings.Idle, func() { p.expire(userID, u) })
+	p.users[userID] = u
+	return u
+}
+
+// touch restarts userID's idle timer, if they have prefetches running.
+func (p *prefetch) touch(userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if u, ok := p.users[userID]; ok && u.idle.Stop() {
+		u.idle.Reset(p.settings.Idle)
+	}
+}
+
+// expire cancels an idle user's prefetches.
+func (p *prefetch) expire(userID string, u *userPrefetch) {
+	p.mu.Lock()
+	if p.users[userID] == u {
+		delete(p.users, userID)
+	}
+	p.mu.Unlock()
+	u.cancel()
+}
+
+// run waits for a slot of the user's and then a global one, so a user with
+// a long queue doesn't hold global slots, and downloads target.
+func (p *prefetch) run(u *userPrefetch, target string, immutable bool, key string) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, key)
+		u.pending--
+		p.mu.Unlock()
+	}()
+	if !acquire(u.ctx, u.slots) {
+		return
+	}
+	defer func() { <-u.slots }()
+	if !acquire(u.ctx, p.global) {
+		return
+	}
+	defer func() { <-p.global }()
+
+	if err := prefetchFile(u.ctx, target, immutable, key); err != nil && u.ctx.Err() == nil {
+		log.Printf("WARN: Prefetching %s failed: %v", target, err)
+	}
+}
+
+func acquire(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// prefetchFile downloads target into the disk cache.
+func prefetchFile(ctx context.Context, target string, immutable bool, key string) error {
+	// The browser may have fetched it while it was queued.
+	if mediaCache.Contains(key) {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream answered %s", resp.Status)
+	}
+	size, ok := wholeBody(resp)
+	if !ok {
+		return nil
+	}
+	v := fileValidators(immutable, target, resp.Header, size)
+	// nil when too big to cache or a browser is streaming it right now.
+	cacheFile := mediaCache.Create(key, cacheMeta(target, resp, size, v))
+	if cacheFile == nil {
+		return nil
+	}
+	if _, err := io.Copy(cacheFile, resp.Body); err != nil {
+		cacheFile.Abort()
+		return err
+	}
+	cacheFile.Commit()
+	return nil
+}
@@ -0,0 +1,249 @@
+package rgp
+
+import (
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/mediacache"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowUpstream serves video once released, counting requests per path and
+// how many run at once.
+type slowUpstream struct {
+	release   chan struct{}
+	cancelled chan string
+
+	mu        sync.Mutex
+	calls     map[string]int
+	active    map[string]int // by the path's prefix up to "-"
+	maxActive map[string]int
+}
+
+func (u *slowUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	group, _, _ := strings.Cut(path, "-")
+	u.mu.Lock()
+	u.calls[path]++
+	for _, g := range []string{group, ""} {
+		u.active[g]++
+		u.maxActive[g] = max(u.maxActive[g], u.active[g])
+	}
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.active[group]--
+		u.active[""]--
+		u.mu.Unlock()
+	}()
+
+	select {
+	case <-u.release:
+	case <-r.Context().Done():
+		u.cancelled <- path
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(video)))
+	w.Write(video)
+}
+
+func (u *slowUpstream) stats() (calls map[string]int, active, maxActive map[string]int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	clone := func(m map[string]int) map[string]int {
+		c := make(map[string]int, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		return c
+	}
+	return clone(u.calls), clone(u.active), clone(u.maxActive)
+}
+
+// startPrefetch enables prefetching into a fresh cache from a slow upstream
+// for the rest of the test.
+func startPrefetch(t *testing.T, settings PrefetchSettings) *slowUpstream {
+	t.Helper()
+	upstream := &slowUpstream{
+		release:   make(chan struct{}),
+		cancelled: make(chan string, 100),
+		calls:     map[string]int{},
+		active:    map[string]int{},
+		maxActive: map[string]int{},
+	}
+	fakeUpstream(t, upstream.ServeHTTP)
+	cache, err := mediacache.New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCache(cache)
+	SetPrefetch(settings)
+	t.Cleanup(func() {
+		p := prefetcher
+		p.mu.Lock()
+		for _, u := range p.users {
+			u.cancel()
+		}
+		p.mu.Unlock()
+		prefetcher = nil
+		SetCache(nil)
+	})
+	return upstream
+}
+
+func (u *slowUpstream) releaseAll() {
+	select {
+	case <-u.release:
+	default:
+		close(u.release)
+	}
+}
+
+func proxyURLs(names ...string) []string {
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = "/rgp/" + name + "?" + auth.SignProxyURL("media", name, false)
+	}
+	return urls
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func cached(names ...string) bool {
+	for _, target := range names {
+		if !mediaCache.Contains(mediacache.Key("https://" + hosts["media"] + "/" + target)) {
+			return false
+		}
+	}
+	return true
+}
+
+func pendingCount() int {
+	prefetcher.mu.Lock()
+	defer prefetcher.mu.Unlock()
+	return len(prefetcher.pending)
+}
+
+func TestPrefetchLimits(t *testing.T) {
+	upstream := startPrefetch(t, PrefetchSettings{PerUser: 2, Global: 3, MaxPending: 10, Idle: time.Minute})
+	var a, b []string
+	for i := range 5 {
+		a = append(a, "a-"+strconv.Itoa(i)+".mp4")
+		b = append(b, "b-"+strconv.Itoa(i)+".mp4")
+	}
+	Prefetch("a", proxyURLs(a...))
+	Prefetch("b", proxyURLs(b...))
+
+	waitFor(t, "the global limit is reached", func() bool {
+		_, active, _ := upstream.stats()
+		return active[""] >= 3
+	})
+	// Give anything over the limits the chance to start.
+	time.Sleep(20 * time.Millisecond)
+	_, _, maxActive := upstream.stats()
+	if maxActive[""] != 3 || maxActive["a"] > 2 || maxActive["b"] > 2 {
+		t.Errorf("at most %d downloads at once, %d for a and %d for b; want 3, and 2 per user",
+			maxActive[""], maxActive["a"], maxActive["b"])
+	}
+
+	upstream.releaseAll()
+	waitFor(t, "everything is cached", func() bool { return cached(append(a, b...)...) })
+	waitFor(t, "nothing is pending", func() bool { return pendingCount() == 0 })
+}
+
+func TestPrefetchMaxPending(t *testing.T) {
+	upstream := startPrefetch(t, PrefetchSettings{PerUser: 1, Global: 1, MaxPending: 2, Idle: time.Minute})
+	Prefetch("a", proxyURLs("a-0.mp4", "a-1.mp4", "a-2.mp4"))
+	// The queue is full until one finishes.
+	Prefetch("a", proxyURLs("a-3.mp4"))
+	if n := pendingCount(); n != 2 {
+		t.Errorf("%d files queued, want 2", n)
+	}
+	upstream.releaseAll()
+	waitFor(t, "the queue is empty", func() bool { return pendingCount() == 0 })
+	if !cached("a-0.mp4", "a-1.mp4") || cached("a-2.mp4") || cached("a-3.mp4") {
+		t.Error("want only the first two files cached")
+	}
+}
+
+func TestPrefetchSkips(t *testing.T) {
+	upstream := startPrefetch(t, PrefetchSettings{PerUser: 2, Global: 2, MaxPending: 10, Idle: time.Minute})
+	upstream.releaseAll()
+	Prefetch("a", proxyURLs("a-0.mp4"))
+	waitFor(t, "the file is cached", func() bool { return cached("a-0.mp4") })
+
+	// Queued files aren't queued twice, by anyone, and cached ones not at all.
+	upstream.release = make(chan struct{})
+	Prefetch("a", proxyURLs("a-1.mp4", "a-1.mp4", "a-0.mp4"))
+	Prefetch("b", proxyURLs("a-1.mp4"))
+	// Neither are safe mode placeholders, other sites, or URLs without a
+	// known host.
+	Prefetch("a", []string{
+		"/rgp/a-2.mp4?" + auth.SignProxyURL("media", "a-2.mp4", true),
+		"https://example.com/a-3.mp4",
+		"/rgp/a-4.mp4?h=example.com",
+	})
+	if n := pendingCount(); n != 1 {
+		t.Errorf("%d files queued, want 1", n)
+	}
+	// Without a user there's nobody to prefetch for.
+	Prefetch("", proxyURLs("a-5.mp4"))
+
+	upstream.releaseAll()
+	waitFor(t, "the queue is empty", func() bool { return pendingCount() == 0 })
+	calls, _, _ := upstream.stats()
+	want := map[string]int{"a-0.mp4": 1, "a-1.mp4": 1}
+	if len(calls) != len(want) || calls["a-0.mp4"] != 1 || calls["a-1.mp4"] != 1 {
+		t.Errorf("upstream requests %v, want %v", calls, want)
+	}
+}
+
+func TestPrefetchIdleCancels(t *testing.T) {
+	const idle = 200 * time.Millisecond
+	upstream := startPrefetch(t, PrefetchSettings{PerUser: 1, Global: 1, MaxPending: 10, Idle: idle})
+	Prefetch("a", proxyURLs("a-0.mp4", "a-1.mp4"))
+	waitFor(t, "a download starts", func() bool {
+		_, active, _ := upstream.stats()
+		return active["a"] == 1
+	})
+
+	// Requests from the user keep their prefetches going.
+	for range 8 {
+		time.Sleep(idle / 4)
+		prefetcher.touch("a")
+	}
+	select {
+	case path := <-upstream.cancelled:
+		t.Fatalf("%s cancelled while the user was active", path)
+	default:
+	}
+
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("download not cancelled once the user went idle")
+	}
+	waitFor(t, "the queue is dropped", func() bool { return pendingCount() == 0 })
+	prefetcher.mu.Lock()
+	users := len(prefetcher.users)
+	prefetcher.mu.Unlock()
+	if users != 0 {
+		t.Errorf("%d users still prefetching", users)
+	}
+	if calls, _, _ := upstream.stats(); len(calls) != 1 || cached("a-0.mp4") || cached("a-1.mp4") {
+		t.Errorf("kept going after the user went idle: %v", calls)
+	}
+}
@@ -1,70 +1,263 @@
 package rgp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/mediacache"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 )
 
-func Serve(w http.ResponseWriter, r *http.Request) {
-	fmt.Println(r.URL.Path)
-	w.WriteHeader(http.StatusOK)
+// mediaCache keeps proxied files on disk; nil disables it.
+var mediaCache *mediacache.Cache
+
+// SetCache sets the disk cache responses are served from and written to.
+func SetCache(cache *mediacache.Cache) {
+	mediaCache = cache
+}
+
+// hosts maps the ?h= short names redgifs.ProxyURL writes to the hosts we
+// proxy. Anything else is refused.
+var hosts = map[string]string{
+	"media":   "media.redgifs.com",
+	"thumbs":  "thumbs.redgifs.com",
+	"userpic": "userpic.redgifs.com",
+	"i":       "i.redgifs.com",
+}
+
+// forwardedRequestHeaders are passed upstream so seeking and conditional
+// requests work.
+var forwardedRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// forwardedResponseHeaders are passed back to the browser, along with the
+// caching headers (see fileValidators).
+var forwardedResponseHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+	"Accept-Ranges",
+}
+
+// client has no overall timeout since bodies are streamed for as long as
+// the browser keeps reading; requests end with the browser's. Compression
+// is off so Content-Length and Content-Range describe the bytes we send.
+// Redirects aren't followed, since they could lead anywhere; they answer
+// as a bad gateway.
+var client = &http.Client{
+	Transport: func() http.RoundTripper {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DisableCompression = true
+		return transport
+	}(),
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
 
-	// Extract host from query parameter (defaults to "media")
-	host := r.URL.Query().Get("h")
-	if host == "" {
-		host = "media"
+// upstreamURL returns the URL /rgp/<path>?h=<host> proxies, given the part
+// of it after /rgp.
+func upstreamURL(u *url.URL) (string, error) {
+	host := u.Query().Get("h")
+	fullHost, ok := hosts[host]
+	if !ok {
+		return "", fmt.Errorf("invalid host: %s", host)
 	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return "", errors.New("missing path")
+	}
+	return "https://" + fullHost + "/" + path, nil
+}
 
-	// Map short host names to full domain
-	hostMap := map[string]string{
-		"media":   "media.redgifs.com",
-		"thumbs":  "thumbs.redgifs.com",
-		"userpic": "userpic.redgifs.com",
-		"i":       "i.redgifs.com",
+// Serve streams a Redgifs media file, or a placeholder in safe mode. Range
+// requests are forwarded so browsers can seek, and upstream's 206 and
+// Content-Range come back as is. Whole files are written through to the disk
+// cache as they stream, and cached files are served from disk.
+func Serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
 
-	fullHost, ok := hostMap[host]
-	if !ok {
+	target, err := upstreamURL(r.URL)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid host: " + host))
+		w.Write([]byte(err.Error()))
 		return
 	}
-
-	// Construct full URL from path and host
-	path := r.URL.Path
-	if path[0] == '/' {
-		path = path[1:]
+	// Only URLs we handed out may be fetched, so the proxy isn't an open
+	// relay onto Redgifs.
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if err := auth.VerifyProxyURL(r.URL.Query().Get("h"), path, r.URL.Query()); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	// Watching keeps the user's prefetches going.
+	if prefetcher != nil {
+		prefetcher.touch(auth.IsLoggedIn(r).Id)
+	}
+	// Safe mode URLs are distinct, so browsers never mix up their cached
+	// placeholders with the real files.
+	if r.URL.Query().Get("sfw") == "1" {
+		servePlaceholder(w, r, path)
+		return
 	}
 
-	newUrl := "https://" + fullHost + "/" + path
-
-	sfw := os.Getenv("SFW")
-	if sfw == "true" {
-		newUrl = "https://c959e687-9816-4324-9b78-6e34277b9c81.mdnplay.dev/shared-assets/videos/flower.mp4"
+	// Conditional requests are only answered 304 when they match: from the
+	// cached validators, or else from upstream's or the ETag synthesized from
+	// its response, which needs the file's size.
+	immutable := immutableHosts[r.URL.Query().Get("h")]
+	key := mediacache.Key(target)
+	if mediaCache != nil {
+		if f, meta, ok := mediaCache.Open(key); ok {
+			defer f.Close()
+			serveCached(w, r, f, meta)
+			return
+		}
 	}
 
-	fmt.Println("Proxying to: " + newUrl)
-	req, err := http.NewRequest("GET", newUrl, nil)
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target, nil)
 	if err != nil {
-		fmt.Println(err)
+		log.Printf("ERROR: Failed to build proxy request for %s: %v", target, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	client := &http.Client{}
+	for _, name := range forwardedRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		if r.Context().Err() == nil {
+			log.Printf("ERROR: Proxy request to %s failed: %v", target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
 		return
 	}
 	defer resp.Body.Close()
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+
+	status := responseStatus(resp.StatusCode)
+	if status != resp.StatusCode {
+		log.Printf("Proxy request to %s answered %s", target, resp.Status)
+	}
+	var v validators
+	switch status {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+		v = fileValidators(immutable, target, resp.Header, fileSize(resp))
+		v.set(w.Header())
+		if status == http.StatusOK && notModified(r, v) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if status == http.StatusOK || status == http.StatusPartialContent || status == http.StatusRequestedRangeNotSatisfiable {
+		for _, name := range forwardedResponseHeaders {
+			if value := resp.Header.Get(name); value != "" {
+				w.Header().Set(name, value)
+			}
+		}
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" && status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.WriteHeader(status)
+	// Only media is passed on: upstream's error pages would be served from
+	// our origin.
+	if (status != http.StatusOK && status != http.StatusPartialContent) || r.Method == http.MethodHead {
 		return
 	}
-	w.Write(bytes)
+
+	var body io.Reader = resp.Body
+	var cacheFile *mediacache.Writer
+	if size, ok := wholeBody(resp); ok && mediaCache != nil {
+		cacheFile = mediaCache.Create(key, cacheMeta(target, resp, size, v))
+	}
+	if cacheFile != nil {
+		body = io.TeeReader(resp.Body, cacheFile)
+	}
+
+	_, err = io.Copy(w, body)
+	if cacheFile != nil {
+		if err == nil {
+			cacheFile.Commit()
+		} else {
+			cacheFile.Abort()
+		}
+	}
+	if err != nil && !errors.Is(err, context.Canceled) && r.Context().Err() == nil {
+		log.Printf("ERROR: Streaming %s failed: %v", target, err)
+	}
+}
+
+// cacheMeta describes a file about to be cached from resp.
+func cacheMeta(target string, resp *http.Response, size int64, v validators) mediacache.Meta {
+	return mediacache.Meta{
+		URL:          target,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Size:         size,
+		ETag:         v.etag,
+		LastModified: v.lastModified,
+		CacheControl: v.cacheControl,
+	}
+}
+
+// serveCached serves a file from the disk cache. http.ServeContent answers
+// Range, If-Range and conditional requests against the stored validators.
+func serveCached(w http.ResponseWriter, r *http.Request, f *os.File, meta mediacache.Meta) {
+	v := validators{etag: meta.ETag, lastModified: meta.LastModified, cacheControl: meta.CacheControl}
+	v.set(w.Header())
+	w.Header().Set("Content-Type", meta.ContentType)
+	modified, err := http.ParseTime(meta.LastModified)
+	if err != nil {
+		modified = meta.Stored
+	}
+	http.ServeContent(w, r, "", modified, f)
+}
+
+// fileSize returns the size of the whole file resp is for, or 0 if unknown.
+func fileSize(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusPartialContent {
+		var first, last, size int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &size); err != nil {
+			return 0
+		}
+		return size
+	}
+	return max(resp.ContentLength, 0)
+}
+
+// wholeBody returns the size of resp's file if resp carries all of it: a
+// 200, or a 206 for the entire file as browsers ask for with "bytes=0-".
+func wholeBody(resp *http.Response) (int64, bool) {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		size := fileSize(resp)
+		return size, size > 0 && resp.ContentLength == size
+	}
+	return 0, false
+}
+
+// responseStatus maps an upstream status to ours. Successful, range and
+// not-modified responses pass through; a missing file is our 404; being throttled makes
+// us unavailable; anything else upstream got wrong is a bad gateway.
+func responseStatus(upstream int) int {
+	switch upstream {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+		return upstream
+	case http.StatusNotFound, http.StatusGone:
+		return http.StatusNotFound
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
 }
@@ -0,0 +1,317 @@
+package rgp
+
+import (
+	"bytes"
+	"kannonfoundry/api-go/api/redgifs"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/mediacache"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeUpstream points every proxied host at handler and signs URLs with a
+// test key for the rest of the test.
+func fakeUpstream(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	t.Setenv("SECRET_KEY", "test secret")
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	oldClient, oldHosts := client, hosts
+	client = &http.Client{Transport: srv.Client().Transport, CheckRedirect: client.CheckRedirect}
+	hosts = map[string]string{}
+	for name := range oldHosts {
+		hosts[name] = srv.Listener.Addr().String()
+	}
+	t.Cleanup(func() { client, hosts = oldClient, oldHosts })
+	return srv
+}
+
+// proxyRequest builds a signed request for path on host as it reaches Serve,
+// after /rgp/ has been stripped.
+func proxyRequest(method, host, path string) *http.Request {
+	return httptest.NewRequest(method, "/"+path+"?"+auth.SignProxyURL(host, path, false), nil)
+}
+
+var video = []byte("0123456789")
+
+func TestServeForwardsRanges(t *testing.T) {
+	var forwarded http.Header
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(video))
+	})
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"", http.StatusOK, "", "0123456789"},
+		{"bytes=2-5", http.StatusPartialContent, "bytes 2-5/10", "2345"},
+		{"bytes=0-", http.StatusPartialContent, "bytes 0-9/10", "0123456789"},
+		{"bytes=20-", http.StatusRequestedRangeNotSatisfiable, "bytes */10", ""},
+	}
+	for _, tt := range tests {
+		r := proxyRequest(http.MethodGet, "media", "Abc.mp4")
+		if tt.rangeHeader != "" {
+			r.Header.Set("Range", tt.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		Serve(w, r)
+
+		if got := forwarded.Get("Range"); got != tt.rangeHeader {
+			t.Errorf("%q: upstream got Range %q", tt.rangeHeader, got)
+		}
+		if w.Code != tt.status {
+			t.Errorf("%q: status %d, want %d", tt.rangeHeader, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("%q: Content-Range %q, want %q", tt.rangeHeader, got, tt.contentRange)
+		}
+		if tt.status == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if got := w.Body.String(); got != tt.body {
+			t.Errorf("%q: body %q, want %q", tt.rangeHeader, got, tt.body)
+		}
+		if got := w.Header().Get("Content-Type"); got != "video/mp4" {
+			t.Errorf("%q: Content-Type %q, want video/mp4", tt.rangeHeader, got)
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(tt.body)) {
+			t.Errorf("%q: Content-Length %s for a %d byte body", tt.rangeHeader, got, len(tt.body))
+		}
+	}
+}
+
+func TestServeForwardsIfRange(t *testing.T) {
+	var forwarded http.Header
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Write(video)
+	})
+	r := proxyRequest(http.MethodGet, "media", "Abc.mp4")
+	r.Header.Set("Range", "bytes=2-5")
+	r.Header.Set("If-Range", `"v1"`)
+	Serve(httptest.NewRecorder(), r)
+	if got := forwarded.Get("If-Range"); got != `"v1"` {
+		t.Errorf("upstream got If-Range %q", got)
+	}
+}
+
+func TestServeHead(t *testing.T) {
+	var method string
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.Header().Set("Content-Length", "10")
+	})
+	w := httptest.NewRecorder()
+	Serve(w, proxyRequest(http.MethodHead, "media", "Abc.mp4"))
+	if method != http.MethodHead || w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("upstream got %s; answered %d with %d bytes", method, w.Code, w.Body.Len())
+	}
+	if got := w.Header().Get("Content-Length"); got != "10" {
+		t.Errorf("Content-Length %q, want 10", got)
+	}
+}
+
+func TestServeConditional(t *testing.T) {
+	var calls int
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(video)))
+		w.Write(video)
+	})
+	get := func(name, value string) *httptest.ResponseRecorder {
+		r := proxyRequest(http.MethodGet, "media", "Abc.mp4")
+		if name != "" {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		Serve(w, r)
+		return w
+	}
+	etag := get("", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag synthesized")
+	}
+
+	tests := []struct {
+		name, value string
+		want        int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"bogus"`, http.StatusOK},
+		{"If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Sun, 01 Jan 2006 00:00:00 GMT", http.StatusOK},
+	}
+	for _, tt := range tests {
+		calls = 0
+		w := get(tt.name, tt.value)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: answered %d, want %d", tt.name, tt.value, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && w.Body.String() != string(video) {
+			t.Errorf("%s %s: body %q", tt.name, tt.value, w.Body.String())
+		}
+		if calls != 1 {
+			t.Errorf("%s %s: %d upstream requests without a cached copy, want 1", tt.name, tt.value, calls)
+		}
+	}
+
+	// A cached copy answers without asking upstream, still only on a match.
+	cache, err := mediacache.New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCache(cache)
+	t.Cleanup(func() { SetCache(nil) })
+	get("", "")
+	calls = 0
+	for _, tt := range tests {
+		if w := get(tt.name, tt.value); w.Code != tt.want {
+			t.Errorf("cached, %s %s: answered %d, want %d", tt.name, tt.value, w.Code, tt.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("%d upstream requests for a cached file", calls)
+	}
+}
+
+func TestServeMapsUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		upstream   int
+		want       int
+		retryAfter string
+	}{
+		{http.StatusNotFound, http.StatusNotFound, ""},
+		{http.StatusGone, http.StatusNotFound, ""},
+		{http.StatusTooManyRequests, http.StatusServiceUnavailable, "30"},
+		{http.StatusServiceUnavailable, http.StatusServiceUnavailable, "30"},
+		{http.StatusForbidden, http.StatusBadGateway, ""},
+		{http.StatusInternalServerError, http.StatusBadGateway, ""},
+		{http.StatusMovedPermanently, http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.Header().Set("Location", "https://example.com/")
+			w.WriteHeader(tt.upstream)
+			w.Write([]byte("upstream error page"))
+		})
+		w := httptest.NewRecorder()
+		Serve(w, proxyRequest(http.MethodGet, "media", "Abc.mp4"))
+		if w.Code != tt.want {
+			t.Errorf("upstream %d: answered %d, want %d", tt.upstream, w.Code, tt.want)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("upstream %d: Retry-After %q, want %q", tt.upstream, got, tt.retryAfter)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("upstream %d: passed on its body %q", tt.upstream, w.Body.String())
+		}
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	var calls int
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) { calls++ })
+
+	unsigned := httptest.NewRequest(http.MethodGet, "/Abc.mp4?h=media", nil)
+	otherPath := proxyRequest(http.MethodGet, "media", "Abc.mp4")
+	otherPath.URL.Path = "/Other.mp4"
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"post", proxyRequest(http.MethodPost, "media", "Abc.mp4"), http.StatusMethodNotAllowed},
+		{"unknown host", proxyRequest(http.MethodGet, "example.com", "Abc.mp4"), http.StatusBadRequest},
+		{"missing path", proxyRequest(http.MethodGet, "media", ""), http.StatusBadRequest},
+		{"unsigned", unsigned, http.StatusForbidden},
+		{"other path", otherPath, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		Serve(w, tt.r)
+		if w.Code != tt.want {
+			t.Errorf("%s: answered %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("made %d upstream requests for rejected ones", calls)
+	}
+}
+
+func TestServeProxyURL(t *testing.T) {
+	var upstreamPath string
+	fakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Write(video)
+	})
+	// URLs handed out by the Redgifs API verify once /rgp/ is stripped and
+	// the path unescaped, exactly as main.go mounts Serve.
+	handler := http.StripPrefix("/rgp/", http.HandlerFunc(Serve))
+	for _, tt := range []struct{ url, path string }{
+		{"https://media.redgifs.com/Abc-mobile.mp4?for=x", "/Abc-mobile.mp4"},
+		{"https://thumbs.redgifs.com/Abc%20Def-poster.jpg", "/Abc Def-poster.jpg"},
+	} {
+		proxied := redgifs.ProxyURL(tt.url, false)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, proxied, nil))
+		if w.Code != http.StatusOK || w.Body.String() != string(video) {
+			t.Errorf("%s: answered %d %q", proxied, w.Code, w.Body.String())
+		}
+		if upstreamPath != tt.path {
+			t.Errorf("%s: upstream got %q, want %q", proxied, upstreamPath, tt.path)
+		}
+	}
+
+	// Dropping sfw from a safe mode URL doesn't get the real file.
+	proxied, _ := url.Parse(redgifs.ProxyURL("https://media.redgifs.com/Abc.mp4", true))
+	query := proxied.Query()
+	query.Del("sfw")
+	proxied.RawQuery = query.Encode()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, proxied.String(), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("safe mode URL without sfw: answered %d, want 403", w.Code)
+	}
+}
+
+func TestFileSize(t *testing.T) {
+	tests := []struct {
+		status        int
+		contentLength int64
+		contentRange  string
+		size          int64
+		whole         bool
+	}{
+		{http.StatusOK, 10, "", 10, true},
+		{http.StatusOK, -1, "", 0, false},
+		{http.StatusPartialContent, 10, "bytes 0-9/10", 10, true},
+		{http.StatusPartialContent, 4, "bytes 2-5/10", 10, false},
+		{http.StatusPartialContent, 4, "bytes 2-5/*", 0, false},
+		{http.StatusNotModified, 0, "", 0, false},
+		{http.StatusNotFound, 9, "", 9, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, ContentLength: tt.contentLength, Header: http.Header{}}
+		if tt.contentRange != "" {
+			resp.Header.Set("Content-Range", tt.contentRange)
+		}
+		if got := fileSize(resp); got != tt.size {
+			t.Errorf("%d %q: fileSize = %d, want %d", tt.status, tt.contentRange, got, tt.size)
+		}
+		if _, whole := wholeBody(resp); whole != tt.whole {
+			t.Errorf("%d %q: wholeBody = %v, want %v", tt.status, tt.contentRange, whole, tt.whole)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package rgp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// immutableCacheControl is sent for files whose URL names their content.
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// defaultCacheControl is sent for other files when upstream sent none.
+	defaultCacheControl = "public, max-age=3600"
+)
+
+// immutableHosts serve files named after their content, so the response for
+// a URL never changes. Avatars on userpic can be replaced in place.
+var immutableHosts = map[string]bool{
+	"media":  true,
+	"thumbs": true,
+	"i":      true,
+}
+
+// validators are the caching headers sent with a file.
+type validators struct {
+	etag         string
+	lastModified string
+	cacheControl string
+}
+
+// fileValidators passes on upstream's validators and fills in what it left
+// out: a long lifetime for immutable files, a default one for the rest,
+// and an ETag derived from the URL and the file's size and date.
+func fileValidators(immutable bool, target string, header http.Header, size int64) validators {
+	v := validators{
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+		cacheControl: header.Get("Cache-Control"),
+	}
+	if immutable {
+		v.cacheControl = immutableCacheControl
+	} else if v.cacheControl == "" {
+		v.cacheControl = defaultCacheControl
+	}
+	if v.etag == "" && size > 0 {
+		sum := sha256.Sum256([]byte(target + "\n" + strconv.FormatInt(size, 10) + "\n" + v.lastModified))
+		v.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if !immutable {
+			// Upstream may change the file without changing its size.
+			v.etag = "W/" + v.etag
+		}
+	}
+	return v
+}
+
+func (v validators) set(header http.Header) {
+	for name, value := range map[string]string{
+		"ETag":          v.etag,
+		"Last-Modified": v.lastModified,
+		"Cache-Control": v.cacheControl,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+}
+
+// notModified reports whether r's conditional headers match v, following
+// RFC 9110: If-None-Match, when present, decides alone.
+func notModified(r *http.Request, v validators) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return v.etag != "" && etagMatches(inm, v.etag)
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(v.lastModified)
+	return err == nil && !modified.After(ims.Truncate(time.Second))
+}
+
+// etagMatches compares an If-None-Match list against etag, weakly.
+func etagMatches(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
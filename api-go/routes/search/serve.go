@@ -1,31 +1,153 @@
 package search
 
 import (
+	"errors"
+	"fmt"
+	"kannonfoundry/api-go/api"
 	"kannonfoundry/api-go/api/redgifs"
+	"kannonfoundry/api-go/auth"
 	"kannonfoundry/api-go/components"
+	"kannonfoundry/api-go/components/layout"
+	"kannonfoundry/api-go/feedsvc"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var dbPool *pgxpool.Pool
+
+func SetDB(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// provider returns the provider picked in the search form's source select.
+func provider(r *http.Request) (api.MediaSearcher, error) {
+	name := r.FormValue("source")
+	p, ok := api.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", api.ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// searchQuery reads the search form (or the equivalent query string).
+func searchQuery(r *http.Request, p api.MediaSearcher, page int) api.Query {
+	minDuration, _ := strconv.ParseFloat(r.FormValue("min_duration"), 64)
+	return api.Query{
+		Tags:         p.ParseTags(r.FormValue("search")),
+		Order:        r.FormValue("order"),
+		MediaType:    r.FormValue("type"),
+		VerifiedOnly: r.FormValue("verified") == "true",
+		MinDuration:  minDuration,
+		Rating:       r.FormValue("rating"),
+		Count:        20,
+		Cursor:       api.PageCursor(page),
+	}
+}
+
+// Filters renders the search form controls for the provider picked in the
+// source select.
+func Filters(w http.ResponseWriter, r *http.Request) {
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	layout.SearchFilters(p).Render(r.Context(), w)
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
-	query := r.FormValue("search")
 	page, err := strconv.Atoi(r.URL.Query().Get("page"))
 	if err != nil || page < 1 {
 		page = 1
 	}
 
-	redgifsapiClient := redgifs.NewClient()
-	files, err := redgifsapiClient.Search([]string{query}, 20, page)
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if r.FormValue("kind") == "creators" {
+		serveCreators(w, r, p, page)
+		return
+	}
+
+	result, err := p.SearchTags(r.Context(), searchQuery(r, p, page))
+	if errors.Is(err, api.ErrSourceUnavailable) {
+		w.WriteHeader(http.StatusOK)
+		components.SourceUnavailable(p.DisplayName(), err).Render(r.Context(), w)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Error during search: " + err.Error()))
 		return
 	}
+	files := result.Files
+
+	safeMode := auth.SafeMode(r)
+	redgifs.FormatFileUrls(files, safeMode)
+	if safeMode {
+		api.UsePlaceholders(files)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if page == 1 {
+		if button := subscribeButton(r, p); button != nil {
+			button.Render(r.Context(), w)
+		}
+	}
+	components.Video(files, safeMode,
+		components.More("/search", page, "search-form")).Render(r.Context(), w)
+}
 
-	redgifs.FormatFileUrls(files)
+// serveCreators renders the Creators tab: matching creators with a one-click
+// subscribe button for logged-in users.
+func serveCreators(w http.ResponseWriter, r *http.Request, p api.MediaSearcher, page int) {
+	if !p.Capabilities().CreatorSearch {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(p.DisplayName() + " doesn't support creator search"))
+		return
+	}
+	query := strings.TrimSpace(r.FormValue("search"))
+
+	creators, _, err := p.SearchCreators(r.Context(), query, 20, api.PageCursor(page))
+	if errors.Is(err, api.ErrSourceUnavailable) {
+		w.WriteHeader(http.StatusOK)
+		components.SourceUnavailable(p.DisplayName(), err).Render(r.Context(), w)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Error during search: " + err.Error()))
+		return
+	}
+	user := auth.IsLoggedIn(r)
+	redgifs.FormatCreatorUrls(creators, user.InSafeMode())
+
+	isLoggedIn := !user.IsEmpty()
+	subscribed := map[string]bool{}
+	if isLoggedIn && dbPool != nil {
+		subs, err := feedsvc.ListUserSubscriptions(r.Context(), dbPool, user.Id)
+		if err != nil {
+			log.Printf("Failed to list subscriptions for %s: %v", user.Id, err)
+		}
+		for _, sub := range subs {
+			if sub.Type == "creator" && sub.Provider == p.Name() {
+				subscribed[sub.SearchTerm] = true
+			}
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 
-	components.Video(files,
+	components.CreatorResults(p.Name(), creators, isLoggedIn, subscribed,
 		components.More("/search", page, "search-form")).Render(r.Context(), w)
 }
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"net/http"
+
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/components"
+	"kannonfoundry/api-go/feedsvc"
+
+	"github.com/a-h/templ"
+)
+
+// searchSubscription maps the search form to a tag subscription's search
+// term on p. ok is false when there is nothing to subscribe to.
+func searchSubscription(r *http.Request, p api.MediaSearcher) (searchTerm string, ok bool) {
+	tags := p.ParseTags(r.FormValue("search"))
+	return p.SearchTerm(tags), len(tags) > 0
+}
+
+// Subscribe creates a feed subscription for the search currently in the
+// search form.
+func Subscribe(w http.ResponseWriter, r *http.Request) {
+	if dbPool == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("database not configured"))
+		return
+	}
+	user := auth.IsLoggedIn(r)
+	if user.IsEmpty() {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Login required"))
+		return
+	}
+
+	p, err := provider(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	searchTerm, ok := searchSubscription(r, p)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing search"))
+		return
+	}
+
+	_, err = feedsvc.CreateSubscription(r.Context(), dbPool, user.Id, p.Name(), "tag", searchTerm)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	components.SubscribeSearchButton(true).Render(r.Context(), w)
+}
+
+// subscribeButton returns the subscribe button for the current search, or
+// nil when the user isn't logged in or there is nothing to subscribe to.
+func subscribeButton(r *http.Request, p api.MediaSearcher) templ.Component {
+	user := auth.IsLoggedIn(r)
+	if user.IsEmpty() || dbPool == nil {
+		return nil
+	}
+	searchTerm, ok := searchSubscription(r, p)
+	if !ok {
+		return nil
+	}
+	sub, err := feedsvc.GetSubscriptionByUserAndTerm(r.Context(), dbPool, user.Id, p.Name(), "tag", searchTerm)
+	return components.SubscribeSearchButton(err == nil && sub != nil)
+}
@@ -0,0 +1,67 @@
+package settings
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"kannonfoundry/api-go/auth"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var dbPool *pgxpool.Pool
+
+func SetDB(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// SafeMode handles the user menu's safe mode toggle (POST on=true|false). The
+// choice is stored and the session cookie reissued with it, so it applies
+// from the next page on.
+func SafeMode(w http.ResponseWriter, r *http.Request) {
+	if dbPool == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("database not configured"))
+		return
+	}
+
+	user := auth.IsLoggedIn(r)
+	if user.IsEmpty() {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	on, err := strconv.ParseBool(r.FormValue("on"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid safe mode setting"))
+		return
+	}
+	if err := auth.SetSafeMode(r.Context(), dbPool, user.Id, on); err != nil {
+		log.Printf("Failed to set safe mode for %s: %v", user.Id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Error saving setting"))
+		return
+	}
+	user.SafeMode = &on
+	if err := auth.SetSessionCookie(w, user); err != nil {
+		log.Printf("Failed to reissue session for %s: %v", user.Id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Error saving setting"))
+		return
+	}
+
+	http.Redirect(w, r, returnPath(r), http.StatusSeeOther)
+}
+
+// returnPath is the page the request came from, as a local path so the
+// redirect can't leave the site.
+func returnPath(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Path == "" || referer.Path[0] != '/' {
+		return "/"
+	}
+	return (&url.URL{Path: referer.Path, RawQuery: referer.RawQuery}).String()
+}
@@ -0,0 +1,58 @@
+package tags
+
+import (
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/components"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	suggestionCount = 10
+	minQueryLength  = 2
+)
+
+// splitQuery returns the tags already typed (as a prefix to keep) and the
+// partial tag being typed, using the provider's tag syntax, e.g.
+// "Gay, Str" -> ("Gay, ", "Str") on Redgifs or "cat -do" -> ("cat ", "-do")
+// on a Booru.
+func splitQuery(provider api.MediaSearcher, search string) (prefix, partial string) {
+	tags := provider.ParseTags(search)
+	if len(tags) == 0 {
+		return "", ""
+	}
+	partial = tags[len(tags)-1]
+	return search[:strings.LastIndex(search, partial)], partial
+}
+
+// Suggest serves /tags/suggest?q= as <option> elements for the search form's
+// datalist. Called from the search box it reads the whole "search" value and
+// suggests for the last tag being typed, from the provider picked in the
+// form's "source" select.
+func Suggest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	provider, ok := api.Get(r.URL.Query().Get("source"))
+	if !ok || !provider.Capabilities().TagSuggest {
+		return
+	}
+
+	prefix, query := "", r.URL.Query().Get("q")
+	if query == "" {
+		prefix, query = splitQuery(provider, r.URL.Query().Get("search"))
+	}
+	if len(strings.TrimPrefix(query, "-")) < minQueryLength {
+		return
+	}
+
+	// Remote providers cache suggestions (see api/cache).
+	suggestions, err := provider.SuggestTags(r.Context(), strings.ToLower(query), suggestionCount)
+	if err != nil {
+		// Suggestions are best effort; an empty list keeps the form usable.
+		log.Printf("Tag suggestions for %q failed: %v", query, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=600")
+	components.TagSuggestions(prefix, suggestions).Render(r.Context(), w)
+}
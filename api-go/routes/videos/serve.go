@@ -0,0 +1,52 @@
+package videos
+
+import (
+	"errors"
+	"kannonfoundry/api-go/api"
+	"kannonfoundry/api-go/api/redgifs"
+	"kannonfoundry/api-go/auth"
+	"kannonfoundry/api-go/components/layout"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Serve renders /videos/{id}?provider=, where id is the provider's item id
+// or a feed video id such as "redgif_<id>". The provider defaults to Redgifs.
+func Serve(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	provider, ok := api.Get(r.URL.Query().Get("provider"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		layout.Root("Video not found", layout.VideoNotFound(id)).Render(r.Context(), w)
+		return
+	}
+
+	file, err := provider.GetItem(r.Context(), id)
+	if errors.Is(err, api.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		layout.Root("Video not found", layout.VideoNotFound(id)).Render(r.Context(), w)
+		return
+	}
+	if errors.Is(err, api.ErrSourceUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(api.RetryAfter(err).Seconds())))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		layout.Root(provider.DisplayName(), layout.SourceUnavailable(provider.DisplayName(), err)).Render(r.Context(), w)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(api.HTTPStatus(err))
+		w.Write([]byte("Error fetching video: " + err.Error()))
+		return
+	}
+
+	safeMode := auth.SafeMode(r)
+	files := []api.FileToSend{*file}
+	redgifs.FormatFileUrls(files, safeMode)
+	if safeMode {
+		api.UsePlaceholders(files)
+	}
+	layout.Root(file.Username, layout.VideoDetail(files[0], safeMode)).Render(r.Context(), w)
+}
@@ -0,0 +1,107 @@
+// Package timeouts applies per-route deadlines in place of a server-wide
+// WriteTimeout, which would cut off long media downloads.
+package timeouts
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// writeGrace is how long past its context deadline a strict handler may
+// keep writing, so it can still answer after giving up on upstream.
+const writeGrace = 5 * time.Second
+
+// Strict gives each request d to finish: its context is cancelled after d
+// and the connection stops accepting writes shortly after.
+func Strict(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Not every ResponseWriter supports deadlines (e.g. in tests);
+			// the context deadline still applies.
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + writeGrace))
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// StreamSettings bounds a streamed response by its progress rather than its
+// total length.
+type StreamSettings struct {
+	// Idle is how long the handler may go without writing, including
+	// before its first byte, before its context is cancelled.
+	Idle time.Duration
+	// Progress is how long each write may take to reach the client.
+	Progress time.Duration
+}
+
+// DefaultStream lets media play on any connection that keeps moving and
+// drops ones that have stalled for half a minute.
+var DefaultStream = StreamSettings{
+	Idle:     30 * time.Second,
+	Progress: 30 * time.Second,
+}
+
+// Stream lets each request run for as long as it keeps writing: every write
+// gets settings.Progress to complete, and the request's context is
+// cancelled once nothing has been written for settings.Idle.
+func Stream(settings StreamSettings) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			// The server's ReadTimeout would otherwise cancel the request
+			// once it expires, however well the response is going.
+			rc.SetReadDeadline(time.Time{})
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			sw := &streamWriter{
+				ResponseWriter: w,
+				rc:             rc,
+				progress:       settings.Progress,
+				idle:           time.AfterFunc(settings.Idle, cancel),
+				idleFor:        settings.Idle,
+			}
+			defer sw.idle.Stop()
+			sw.extend()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+		})
+	}
+}
+
+// streamWriter pushes the write deadline and idle timer forward on every
+// write.
+type streamWriter struct {
+	http.ResponseWriter
+	rc       *http.ResponseController
+	progress time.Duration
+	idle     *time.Timer
+	idleFor  time.Duration
+}
+
+func (sw *streamWriter) extend() {
+	sw.idle.Reset(sw.idleFor)
+	sw.rc.SetWriteDeadline(time.Now().Add(sw.progress))
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.extend()
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *streamWriter) WriteHeader(status int) {
+	sw.extend()
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *streamWriter) Flush() {
+	sw.extend()
+	sw.rc.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,123 @@
+package timeouts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs handler behind middleware on a real server, since deadlines
+// need a connection.
+func serve(t *testing.T, middleware func(http.Handler) http.Handler, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(middleware(handler))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStrict(t *testing.T) {
+	done := make(chan time.Duration, 1)
+	srv := serve(t, Strict(50*time.Millisecond), func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		<-r.Context().Done()
+		done <- time.Since(start)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if waited := <-done; waited > time.Second {
+		t.Errorf("context cancelled after %s, want 50ms", waited)
+	}
+	// The handler can still answer once its context is done.
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want 504", resp.StatusCode)
+	}
+}
+
+func TestStreamIdle(t *testing.T) {
+	done := make(chan time.Duration, 1)
+	srv := serve(t, Stream(StreamSettings{Idle: 50 * time.Millisecond, Progress: time.Second}), func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		<-r.Context().Done()
+		done <- time.Since(start)
+	})
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if waited := <-done; waited < 40*time.Millisecond || waited > time.Second {
+		t.Errorf("idle request cancelled after %s, want 50ms", waited)
+	}
+}
+
+func TestStreamKeepsGoingWhileWriting(t *testing.T) {
+	const chunks = 10
+	srv := serve(t, Stream(StreamSettings{Idle: 50 * time.Millisecond, Progress: time.Second}), func(w http.ResponseWriter, r *http.Request) {
+		// Twice the idle timeout in all, but never idle for long.
+		for i := range chunks {
+			if r.Context().Err() != nil {
+				return
+			}
+			fmt.Fprintf(w, "%d", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "0123456789" {
+		t.Errorf("got %q, want every chunk", got)
+	}
+}
+
+func TestStreamProgress(t *testing.T) {
+	writeErr := make(chan error, 1)
+	srv := serve(t, Stream(StreamSettings{Idle: time.Minute, Progress: 50 * time.Millisecond}), func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 64<<10)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+	})
+
+	// A client that sends a request and never reads the response.
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || !strings.Contains(line, "200") {
+		t.Fatalf("status line %q, %v", line, err)
+	}
+
+	select {
+	case err := <-writeErr:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("write failed with %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes to a stalled client never timed out")
+	}
+}